@@ -0,0 +1,235 @@
+// Package crypto seals sensitive row values (account passwords, OAuth2
+// refresh tokens, and optionally notification content) in an AEAD envelope
+// so they're never written to Postgres in plaintext. The master key is
+// either a raw base64-encoded key (MASTER_KEY) or a KMS URL -- awskms://,
+// gcpkms://, hashivault:// -- resolved through gocloud.dev/secrets.
+package crypto
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"gocloud.dev/secrets"
+)
+
+// envelopeSep separates the ID of the key an envelope was sealed under
+// from its ciphertext, so a row can be decrypted without a side table
+// tracking which key touched it.
+const envelopeSep = "$"
+
+// Active is the process-wide Keeper used by EncryptedString's Value/Scan.
+// main sets it during startup, before the first query touching an
+// encrypted column; keyrotate replaces it with a dual-key Keeper for the
+// duration of the rotation.
+var Active *Keeper
+
+// Keeper seals and opens values under a master key, and optionally a
+// previous key kept around read-only so rows sealed before a rotation
+// keep decrypting until keyrotate rewrites them.
+type Keeper struct {
+	keyID string
+	local cipher.AEAD     // set when the key source was a raw key
+	kms   *secrets.Keeper // set when the key source was a KMS URL
+
+	prevKeyID string
+	prevLocal cipher.AEAD
+	prevKMS   *secrets.Keeper
+}
+
+// Open builds a Keeper from a key source: a KMS URL (awskms://, gcpkms://,
+// hashivault://) resolved via gocloud.dev/secrets, or a raw base64-encoded
+// chacha20poly1305 key. keyID labels envelopes sealed with this key; use a
+// new keyID whenever keySource changes so old and new envelopes can be
+// told apart during rotation.
+func Open(ctx context.Context, keyID, keySource string) (*Keeper, error) {
+	if keyID == "" {
+		return nil, errors.New("crypto: keyID must not be empty")
+	}
+	if isKMSURL(keySource) {
+		kmsKeeper, err := secrets.OpenKeeper(ctx, keySource)
+		if err != nil {
+			return nil, fmt.Errorf("crypto: open KMS keeper %q: %w", keySource, err)
+		}
+		return &Keeper{keyID: keyID, kms: kmsKeeper}, nil
+	}
+
+	local, err := newLocalAEAD(keySource)
+	if err != nil {
+		return nil, err
+	}
+	return &Keeper{keyID: keyID, local: local}, nil
+}
+
+// WithPrevious returns a copy of k that additionally accepts envelopes
+// sealed under prevKeySource for decryption only -- Seal always uses k's
+// own key. This is the read half of keyrotate's zero-downtime rotation.
+func (k *Keeper) WithPrevious(ctx context.Context, prevKeyID, prevKeySource string) (*Keeper, error) {
+	k2 := *k
+	if isKMSURL(prevKeySource) {
+		kmsKeeper, err := secrets.OpenKeeper(ctx, prevKeySource)
+		if err != nil {
+			return nil, fmt.Errorf("crypto: open previous KMS keeper %q: %w", prevKeySource, err)
+		}
+		k2.prevKeyID, k2.prevKMS = prevKeyID, kmsKeeper
+		return &k2, nil
+	}
+
+	local, err := newLocalAEAD(prevKeySource)
+	if err != nil {
+		return nil, err
+	}
+	k2.prevKeyID, k2.prevLocal = prevKeyID, local
+	return &k2, nil
+}
+
+func newLocalAEAD(b64Key string) (cipher.AEAD, error) {
+	key, err := base64.StdEncoding.DecodeString(b64Key)
+	if err != nil {
+		return nil, fmt.Errorf("crypto: decode key: %w", err)
+	}
+	if len(key) != chacha20poly1305.KeySize {
+		return nil, fmt.Errorf("crypto: key must decode to %d bytes, got %d", chacha20poly1305.KeySize, len(key))
+	}
+	return chacha20poly1305.New(key)
+}
+
+func isKMSURL(s string) bool {
+	for _, scheme := range []string{"awskms://", "gcpkms://", "hashivault://"} {
+		if strings.HasPrefix(s, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Seal encrypts plaintext under k's current key and returns the stored
+// representation: "<keyID>$<base64 ciphertext>".
+func (k *Keeper) Seal(ctx context.Context, plaintext string) (string, error) {
+	ciphertext, err := seal(ctx, k.kms, k.local, plaintext)
+	if err != nil {
+		return "", fmt.Errorf("crypto: seal: %w", err)
+	}
+	return k.keyID + envelopeSep + base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt opens an envelope produced by Seal, trying k's current key and
+// falling back to the previous key (if WithPrevious configured one) when
+// the envelope was sealed under a different key ID.
+func (k *Keeper) Decrypt(ctx context.Context, envelope string) (string, error) {
+	id, raw, ok := strings.Cut(envelope, envelopeSep)
+	if !ok {
+		return "", errors.New("crypto: malformed envelope")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return "", fmt.Errorf("crypto: decode envelope: %w", err)
+	}
+
+	switch id {
+	case k.keyID:
+		return open(ctx, k.kms, k.local, ciphertext)
+	case k.prevKeyID:
+		if k.prevKMS == nil && k.prevLocal == nil {
+			return "", fmt.Errorf("crypto: envelope sealed under unconfigured key %q", id)
+		}
+		return open(ctx, k.prevKMS, k.prevLocal, ciphertext)
+	default:
+		return "", fmt.Errorf("crypto: envelope sealed under unknown key %q", id)
+	}
+}
+
+func seal(ctx context.Context, kms *secrets.Keeper, local cipher.AEAD, plaintext string) ([]byte, error) {
+	if kms != nil {
+		return kms.Encrypt(ctx, []byte(plaintext))
+	}
+	nonce := make([]byte, local.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return local.Seal(nonce, nonce, []byte(plaintext), nil), nil
+}
+
+func open(ctx context.Context, kms *secrets.Keeper, local cipher.AEAD, ciphertext []byte) (string, error) {
+	if kms != nil {
+		plaintext, err := kms.Decrypt(ctx, ciphertext)
+		if err != nil {
+			return "", err
+		}
+		return string(plaintext), nil
+	}
+	if len(ciphertext) < local.NonceSize() {
+		return "", errors.New("ciphertext shorter than nonce")
+	}
+	nonce, ct := ciphertext[:local.NonceSize()], ciphertext[local.NonceSize():]
+	plaintext, err := local.Open(nil, nonce, ct, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// EncryptedString is a GORM-compatible string column that's transparently
+// sealed on write and opened on read through the process-wide Active
+// keeper. Use it in place of string for columns holding secrets (account
+// passwords, refresh tokens) or, optionally, message content.
+type EncryptedString string
+
+// Value implements driver.Valuer, sealing e under Active before it's
+// written to the database.
+func (e EncryptedString) Value() (driver.Value, error) {
+	if e == "" {
+		return "", nil
+	}
+	if Active == nil {
+		return nil, errors.New("crypto: Active keeper not configured")
+	}
+	return Active.Seal(context.Background(), string(e))
+}
+
+// Scan implements sql.Scanner, opening the envelope read from the
+// database through Active.
+func (e *EncryptedString) Scan(value any) error {
+	if value == nil {
+		*e = ""
+		return nil
+	}
+
+	var raw string
+	switch v := value.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	default:
+		return fmt.Errorf("crypto: cannot scan %T into EncryptedString", value)
+	}
+	if raw == "" {
+		*e = ""
+		return nil
+	}
+	if Active == nil {
+		return errors.New("crypto: Active keeper not configured")
+	}
+
+	plaintext, err := Active.Decrypt(context.Background(), raw)
+	if err != nil {
+		return fmt.Errorf("crypto: %w", err)
+	}
+	*e = EncryptedString(plaintext)
+	return nil
+}
+
+// GormDataType tells GORM's migrator to store EncryptedString as text --
+// the envelope is just an opaque, if longer, string.
+func (EncryptedString) GormDataType() string {
+	return "text"
+}
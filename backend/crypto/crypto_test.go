@@ -0,0 +1,151 @@
+package crypto
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+func testKey(t *testing.T, seed byte) string {
+	t.Helper()
+	key := make([]byte, chacha20poly1305.KeySize)
+	for i := range key {
+		key[i] = seed
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	keeper, err := Open(ctx, "k1", testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	envelope, err := keeper.Seal(ctx, "hunter2")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if envelope == "" {
+		t.Fatal("Seal returned an empty envelope")
+	}
+
+	plaintext, err := keeper.Decrypt(ctx, envelope)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if plaintext != "hunter2" {
+		t.Errorf("Decrypt = %q, want %q", plaintext, "hunter2")
+	}
+}
+
+func TestDecryptRejectsUnknownKeyID(t *testing.T) {
+	ctx := context.Background()
+	sealer, err := Open(ctx, "k1", testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Open sealer: %v", err)
+	}
+	envelope, err := sealer.Seal(ctx, "secret")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+
+	opener, err := Open(ctx, "k2", testKey(t, 2))
+	if err != nil {
+		t.Fatalf("Open opener: %v", err)
+	}
+	if _, err := opener.Decrypt(ctx, envelope); err == nil {
+		t.Error("expected Decrypt to fail for an envelope sealed under an unconfigured key")
+	}
+}
+
+func TestWithPreviousDecryptsOldEnvelopes(t *testing.T) {
+	ctx := context.Background()
+
+	oldKeeper, err := Open(ctx, "k1", testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Open old: %v", err)
+	}
+	oldEnvelope, err := oldKeeper.Seal(ctx, "before rotation")
+	if err != nil {
+		t.Fatalf("Seal old: %v", err)
+	}
+
+	newKeeper, err := Open(ctx, "k2", testKey(t, 2))
+	if err != nil {
+		t.Fatalf("Open new: %v", err)
+	}
+	rotated, err := newKeeper.WithPrevious(ctx, "k1", testKey(t, 1))
+	if err != nil {
+		t.Fatalf("WithPrevious: %v", err)
+	}
+
+	// Envelopes sealed under the previous key still decrypt...
+	plaintext, err := rotated.Decrypt(ctx, oldEnvelope)
+	if err != nil {
+		t.Fatalf("Decrypt old envelope after rotation: %v", err)
+	}
+	if plaintext != "before rotation" {
+		t.Errorf("Decrypt = %q, want %q", plaintext, "before rotation")
+	}
+
+	// ...but new envelopes are always sealed under the current key.
+	newEnvelope, err := rotated.Seal(ctx, "after rotation")
+	if err != nil {
+		t.Fatalf("Seal after rotation: %v", err)
+	}
+	if _, err := oldKeeper.Decrypt(ctx, newEnvelope); err == nil {
+		t.Error("expected the old keeper to reject an envelope sealed under the new key")
+	}
+}
+
+func TestEncryptedStringValueScanRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	keeper, err := Open(ctx, "k1", testKey(t, 1))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	prevActive := Active
+	Active = keeper
+	defer func() { Active = prevActive }()
+
+	e := EncryptedString("s3cr3t")
+	stored, err := e.Value()
+	if err != nil {
+		t.Fatalf("Value: %v", err)
+	}
+
+	var scanned EncryptedString
+	if err := scanned.Scan(stored); err != nil {
+		t.Fatalf("Scan: %v", err)
+	}
+	if scanned != e {
+		t.Errorf("Scan round-trip = %q, want %q", scanned, e)
+	}
+}
+
+func TestEncryptedStringEmptyValueSkipsEncryption(t *testing.T) {
+	prevActive := Active
+	Active = nil
+	defer func() { Active = prevActive }()
+
+	e := EncryptedString("")
+	stored, err := e.Value()
+	if err != nil {
+		t.Fatalf("Value on empty string should not require Active: %v", err)
+	}
+	if stored != "" {
+		t.Errorf("Value() = %v, want empty string", stored)
+	}
+
+	var scanned EncryptedString
+	if err := scanned.Scan(nil); err != nil {
+		t.Fatalf("Scan(nil): %v", err)
+	}
+	if scanned != "" {
+		t.Errorf("Scan(nil) = %q, want empty", scanned)
+	}
+}
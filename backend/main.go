@@ -2,10 +2,20 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/mail"
 	"os"
 	"strconv"
@@ -18,23 +28,274 @@ import (
 	"github.com/gofiber/websocket/v2"
 	"github.com/emersion/go-imap"
 	"github.com/emersion/go-imap/client"
+	idle "github.com/emersion/go-imap-idle"
+	move "github.com/emersion/go-imap-move"
+	emmail "github.com/emersion/go-message/mail"
+	"github.com/emersion/go-sasl"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/oauth2"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+
+	"email-notifier/backend/crypto"
+	"email-notifier/backend/notifiers"
+	"email-notifier/backend/rules"
+	"email-notifier/backend/storage"
+	"email-notifier/backend/telemetry"
+)
+
+// idleTimeout is how long an IDLE command is left running before we DONE and
+// re-IDLE: a little under the 29 minutes RFC 2177 allows before the server
+// may drop the connection.
+const idleTimeout = 28 * time.Minute
+
+// maxReconnectBackoff caps the exponential backoff used when a persistent
+// IMAP connection is lost and needs to be re-established.
+const maxReconnectBackoff = 5 * time.Minute
+
+// imapBodySection requests the full RFC822 message without marking it as
+// \Seen, so fetching the body for archival doesn't affect the mailbox.
+var imapBodySection = &imap.BodySectionName{Peek: true}
+
+// snippetLen bounds how much of a message's plain-text body is kept as a
+// quick preview in EmailBody.Snippet.
+const snippetLen = 280
+
+func init() {
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
+}
+
+// oauthProviderEndpoints are the well-known authorization/token endpoints
+// for the providers we support out of the box. A custom TokenURL on the
+// account overrides oauthProviderEndpoints[provider].TokenURL; oauthCallback
+// stores the token URL it used on the account, and ensureFreshToken
+// refreshes against that.
+var oauthProviderEndpoints = map[string]oauth2.Endpoint{
+	"gmail": {
+		AuthURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL: "https://oauth2.googleapis.com/token",
+	},
+	"o365": {
+		AuthURL:  "https://login.microsoftonline.com/common/oauth2/v2.0/authorize",
+		TokenURL: "https://login.microsoftonline.com/common/oauth2/v2.0/token",
+	},
+}
+
+var oauthProviderScopes = map[string][]string{
+	"gmail": {"https://mail.google.com/"},
+	"o365":  {"https://outlook.office.com/IMAP.AccessAsUser.All", "offline_access"},
+}
+
+// oauthPendingMux guards oauthPending, the in-memory state->account mapping
+// used to correlate an OAuth2 callback with the authorize request that
+// started it.
+var (
+	oauthPendingMux sync.Mutex
+	oauthPending    = make(map[string]oauthPendingAuth)
 )
 
+type oauthPendingAuth struct {
+	AccountID uint
+	Provider  string
+}
+
+func oauthRedirectURI() string {
+	return getEnv("OAUTH_REDIRECT_URI", "http://localhost:8081/api/accounts/oauth/callback")
+}
+
+func oauthConfigFor(account *EmailAccount, provider string) *oauth2.Config {
+	endpoint := oauthProviderEndpoints[provider]
+	if account.TokenURL != "" {
+		endpoint.TokenURL = account.TokenURL
+	}
+	return &oauth2.Config{
+		ClientID:     account.ClientID,
+		ClientSecret: account.ClientSecret,
+		Endpoint:     endpoint,
+		Scopes:       oauthProviderScopes[provider],
+		RedirectURL:  oauthRedirectURI(),
+	}
+}
+
+// ensureFreshToken refreshes account.AccessToken if it's expired or about to
+// expire, persisting the new token (and, if the provider rotated it, the new
+// refresh token) back to the DB.
+func ensureFreshToken(account *EmailAccount) error {
+	if account.AuthType != "xoauth2" {
+		return nil
+	}
+	if account.AccessToken != "" && time.Until(account.TokenExpiry) > time.Minute {
+		return nil
+	}
+
+	endpoint := oauth2.Endpoint{TokenURL: account.TokenURL}
+	if endpoint.TokenURL == "" {
+		return fmt.Errorf("account %s has no OAuth2 token URL configured", account.Email)
+	}
+	cfg := &oauth2.Config{
+		ClientID:     account.ClientID,
+		ClientSecret: account.ClientSecret,
+		Endpoint:     endpoint,
+	}
+
+	src := cfg.TokenSource(context.Background(), &oauth2.Token{RefreshToken: string(account.RefreshToken)})
+	token, err := src.Token()
+	if err != nil {
+		return fmt.Errorf("refresh token: %w", err)
+	}
+
+	account.AccessToken = token.AccessToken
+	account.TokenExpiry = token.Expiry
+	if token.RefreshToken != "" {
+		account.RefreshToken = crypto.EncryptedString(token.RefreshToken)
+	}
+	db.Model(account).Updates(map[string]any{
+		"access_token":  account.AccessToken,
+		"token_expiry":  account.TokenExpiry,
+		"refresh_token": account.RefreshToken,
+	})
+	return nil
+}
+
+// xoauth2Client implements sasl.Client for the (non-standard, but
+// widely-deployed) XOAUTH2 mechanism used by Gmail and Microsoft 365. The
+// upstream go-sasl package doesn't ship it, so we speak it directly:
+// https://developers.google.com/gmail/imap/xoauth2-protocol
+type xoauth2Client struct {
+	username, token string
+}
+
+func newXoauth2Client(username, token string) sasl.Client {
+	return &xoauth2Client{username: username, token: token}
+}
+
+func (c *xoauth2Client) Start() (mech string, ir []byte, err error) {
+	ir = []byte("user=" + c.username + "\x01auth=Bearer " + c.token + "\x01\x01")
+	return "XOAUTH2", ir, nil
+}
+
+func (c *xoauth2Client) Next(challenge []byte) ([]byte, error) {
+	// A non-empty challenge here means the server rejected the token; IMAP
+	// expects an empty response to let the server terminate the exchange.
+	return nil, nil
+}
+
+// imapAuthenticate logs in to the IMAP connection using whichever
+// authentication scheme the account is configured for.
+func imapAuthenticate(c *client.Client, account *EmailAccount) error {
+	if account.AuthType != "xoauth2" {
+		return c.Login(account.Email, string(account.Password))
+	}
+
+	if err := ensureFreshToken(account); err != nil {
+		return err
+	}
+	return c.Authenticate(newXoauth2Client(account.Email, account.AccessToken))
+}
+
+func oauthAuthorize(c *fiber.Ctx) error {
+	provider := c.Query("provider")
+	if _, ok := oauthProviderEndpoints[provider]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown provider"})
+	}
+
+	var account EmailAccount
+	if err := db.First(&account, c.Query("account_id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Account not found"})
+	}
+
+	state := randomState()
+	oauthPendingMux.Lock()
+	oauthPending[state] = oauthPendingAuth{AccountID: account.ID, Provider: provider}
+	oauthPendingMux.Unlock()
+
+	cfg := oauthConfigFor(&account, provider)
+	return c.Redirect(cfg.AuthCodeURL(state, oauth2.AccessTypeOffline))
+}
+
+func oauthCallback(c *fiber.Ctx) error {
+	state := c.Query("state")
+	code := c.Query("code")
+
+	oauthPendingMux.Lock()
+	pending, ok := oauthPending[state]
+	delete(oauthPending, state)
+	oauthPendingMux.Unlock()
+	if !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "unknown or expired state"})
+	}
+
+	var account EmailAccount
+	if err := db.First(&account, pending.AccountID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Account not found"})
+	}
+
+	cfg := oauthConfigFor(&account, pending.Provider)
+	token, err := cfg.Exchange(context.Background(), code)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	account.AuthType = "xoauth2"
+	account.TokenURL = cfg.Endpoint.TokenURL
+	account.AccessToken = token.AccessToken
+	account.RefreshToken = crypto.EncryptedString(token.RefreshToken)
+	account.TokenExpiry = token.Expiry
+	if err := db.Save(&account).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"success": true})
+}
+
+func randomState() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
 type EmailAccount struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Email     string    `json:"email" gorm:"uniqueIndex"`
-	Password  string    `json:"password"`
-	Host      string    `json:"host"`
-	Port      int       `json:"port"`
-	Protocol  string    `json:"protocol"`
-	IsActive  bool      `json:"isActive" gorm:"default:true"`
-	LastCheck time.Time `json:"lastCheck"`
+	ID        uint                   `json:"id" gorm:"primaryKey"`
+	Email     string                 `json:"email" gorm:"uniqueIndex"`
+	Password  crypto.EncryptedString `json:"password,omitempty"`
+	Host      string                 `json:"host"`
+	Port      int                    `json:"port"`
+	Protocol  string                 `json:"protocol"`
+	IsActive  bool                   `json:"isActive" gorm:"default:true"`
+	LastCheck time.Time              `json:"lastCheck"`
+	LastUID   uint32                 `json:"lastUid" gorm:"default:0"`
+
+	// CertFingerprint, if set, pins the IMAP/POP3 server's leaf certificate
+	// to this hex-encoded SHA-256 digest, on top of normal chain
+	// validation against the system root CAs.
+	CertFingerprint string `json:"certFingerprint,omitempty"`
+
+	// AuthType is "password" (the default, plain LOGIN/USER+PASS) or
+	// "xoauth2" for providers like Gmail/Microsoft 365 that require OAuth2.
+	AuthType     string                 `json:"authType" gorm:"default:password"`
+	ClientID     string                 `json:"clientId,omitempty"`
+	ClientSecret string                 `json:"clientSecret,omitempty"`
+	TokenURL     string                 `json:"tokenUrl,omitempty"`
+	RefreshToken crypto.EncryptedString `json:"-"`
+	AccessToken  string                 `json:"-"`
+	TokenExpiry  time.Time              `json:"-"`
+
 	CreatedAt time.Time `json:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt"`
 }
 
+// MarshalJSON redacts Password and ClientSecret before an EmailAccount is
+// ever serialized back to a client -- createAccount/updateAccount still
+// read them in via BodyParser, which decodes the json tags above
+// directly and never goes through this method.
+func (a EmailAccount) MarshalJSON() ([]byte, error) {
+	type alias EmailAccount
+	out := alias(a)
+	out.Password = ""
+	out.ClientSecret = ""
+	return json.Marshal(out)
+}
+
 type EmailNotification struct {
 	ID           uint      `json:"id" gorm:"primaryKey"`
 	AccountEmail string    `json:"accountEmail"`
@@ -42,9 +303,81 @@ type EmailNotification struct {
 	Subject      string    `json:"subject"`
 	MessageID    string    `json:"messageId" gorm:"uniqueIndex"`
 	ReceivedAt   time.Time `json:"receivedAt"`
+	Priority     int       `json:"priority" gorm:"default:0"`
+	Tags         []Tag     `json:"tags,omitempty" gorm:"many2many:notification_tags;"`
 	CreatedAt    time.Time `json:"createdAt"`
 }
 
+// Tag is a user-defined label that rules (or, eventually, users) can attach
+// to notifications via the "tag" rule action.
+type Tag struct {
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name" gorm:"uniqueIndex"`
+}
+
+// Rule is a per-account filter evaluated against every new message before
+// it's stored. ConditionExpr and ActionsJSON are JSON, parsed by the rules
+// package; see rules.Parse and rules.ParseActions for their shape.
+type Rule struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	AccountID     uint      `json:"accountId" gorm:"index"`
+	Priority      int       `json:"priority"`
+	ConditionExpr string    `json:"conditionExpr" gorm:"type:text"`
+	ActionsJSON   string    `json:"actionsJson" gorm:"type:text"`
+	Enabled       bool      `json:"enabled" gorm:"default:true"`
+	CreatedAt     time.Time `json:"createdAt"`
+	UpdatedAt     time.Time `json:"updatedAt"`
+}
+
+// NotificationSink is a per-account delivery destination for new-mail
+// events (webhook, SMTP relay, or mobile push). Config holds the
+// sink-type-specific settings as JSON; see notifiers.SinkConfig.
+type NotificationSink struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	AccountEmail string    `json:"accountEmail" gorm:"index"`
+	Type         string    `json:"type"`
+	Config       string    `json:"config" gorm:"type:text"`
+	Enabled      bool      `json:"enabled" gorm:"default:true"`
+	CreatedAt    time.Time `json:"createdAt"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+}
+
+// DeadLetter records a notification delivery that failed on every retry
+// attempt, so operators can see and (eventually) replay it.
+type DeadLetter struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	SinkID    uint      `json:"sinkId" gorm:"index"`
+	MessageID string    `json:"messageId"`
+	Error     string    `json:"error"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// EmailBody holds the parsed full body of a notification's message,
+// fetched and stored in addition to the lightweight envelope metadata.
+type EmailBody struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	NotificationID uint   `json:"notificationId" gorm:"uniqueIndex"`
+	Plain          string `json:"plain"`
+	HTML           string `json:"html"`
+	Snippet        string `json:"snippet"`
+	Size           int    `json:"size"`
+	HasAttachments bool   `json:"hasAttachments"`
+}
+
+// EmailAttachment is one file extracted from a message's MIME parts. The
+// bytes themselves live in blob storage at StoragePath; only metadata is in
+// Postgres.
+type EmailAttachment struct {
+	ID             uint   `json:"id" gorm:"primaryKey"`
+	NotificationID uint   `json:"notificationId" gorm:"index"`
+	Filename       string `json:"filename"`
+	Mime           string `json:"mime"`
+	Size           int    `json:"size"`
+	SHA256         string `json:"sha256"`
+	StoragePath    string `json:"-"`
+}
+
 type WSMessage struct {
 	Type    string              `json:"type"`
 	Payload json.RawMessage     `json:"payload,omitempty"`
@@ -56,33 +389,89 @@ var (
 	wsClients     = make(map[*websocket.Conn]bool)
 	wsClientsMux  sync.RWMutex
 	checkInterval time.Duration
+	dispatcher    *notifiers.Dispatcher
+	blobStore     storage.Blob
 )
 
+// dbDSN builds the Postgres connection string from the same DB_* env vars
+// the server and the keyrotate subcommand both read.
+func dbDSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		getEnv("DB_HOST", "localhost"), getEnv("DB_PORT", "5432"), getEnv("DB_USER", "postgres"),
+		getEnv("DB_PASSWORD", "root"), getEnv("DB_NAME", "postgres"))
+}
+
+// initCrypto loads the master key (and, if set, the previous key being
+// rotated away from) into crypto.Active so EncryptedString columns can be
+// sealed and opened for the rest of the process.
+func initCrypto(ctx context.Context) {
+	keeper, err := crypto.Open(ctx, getEnv("MASTER_KEY_ID", "default"), getEnv("MASTER_KEY", ""))
+	if err != nil {
+		slog.Error("failed to initialize crypto keeper", "error", err)
+		os.Exit(1)
+	}
+	if prevID, prevKey := getEnv("CRYPTO_PREV_KEY_ID", ""), getEnv("CRYPTO_PREV_KEY", ""); prevID != "" && prevKey != "" {
+		keeper, err = keeper.WithPrevious(ctx, prevID, prevKey)
+		if err != nil {
+			slog.Error("failed to initialize previous crypto key", "error", err)
+			os.Exit(1)
+		}
+	}
+	crypto.Active = keeper
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keyrotate" {
+		runKeyRotate(os.Args[2:])
+		return
+	}
+
 	// Load environment variables
-	dbHost := getEnv("DB_HOST", "localhost")
-	dbPort := getEnv("DB_PORT", "5432")
-	dbUser := getEnv("DB_USER", "postgres")
-	dbPassword := getEnv("DB_PASSWORD", "root")
-	dbName := getEnv("DB_NAME", "postgres")
 	serverPort := getEnv("SERVER_PORT", "8081")
 	checkIntervalStr := getEnv("CHECK_INTERVAL", "10")
-	
+
 	checkIntervalInt, err := strconv.Atoi(checkIntervalStr)
 	if err != nil {
 		checkIntervalInt = 10
 	}
 	checkInterval = time.Duration(checkIntervalInt) * time.Second
 
+	initCrypto(context.Background())
+
+	shutdownTracer, err := telemetry.InitTracer(context.Background(), "email-notifier")
+	if err != nil {
+		slog.Error("failed to initialize tracer", "error", err)
+		os.Exit(1)
+	}
+	defer shutdownTracer(context.Background())
+
 	// Connect to database
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		dbHost, dbPort, dbUser, dbPassword, dbName)
-	db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err = gorm.Open(postgres.Open(dbDSN()), &gorm.Config{})
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+
+	db.AutoMigrate(&EmailAccount{}, &EmailNotification{}, &NotificationSink{}, &DeadLetter{},
+		&EmailBody{}, &EmailAttachment{}, &Rule{}, &Tag{})
+	setupSearchIndex()
+
+	blobStore, err = storage.New(getEnv("BLOB_STORAGE_URI", "file://./data/blobs"))
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		slog.Error("failed to initialize blob storage", "error", err)
+		os.Exit(1)
 	}
 
-	db.AutoMigrate(&EmailAccount{}, &EmailNotification{})
+	dispatcher = notifiers.NewDispatcher()
+	dispatcher.OnFailure = func(sink notifiers.ConfiguredSink, n notifiers.Notification, err error, attempts int) {
+		slog.Error("sink delivery failed", "sink_id", sink.ID, "attempts", attempts, "message_id", n.MessageID, "error", err)
+		db.Create(&DeadLetter{
+			SinkID:    sink.ID,
+			MessageID: n.MessageID,
+			Error:     err.Error(),
+			Attempts:  attempts,
+		})
+	}
 
 	app := fiber.New(fiber.Config{
 		ReadTimeout:  30 * time.Second,
@@ -93,6 +482,9 @@ func main() {
 		AllowOrigins: getEnv("CORS_ORIGINS", "*"),
 		AllowHeaders: "Origin, Content-Type, Accept",
 	}))
+	app.Use(telemetry.Middleware())
+
+	app.Get("/metrics", telemetry.Handler())
 
 	// REST API endpoints
 	app.Get("/api/accounts", getAccounts)
@@ -100,6 +492,21 @@ func main() {
 	app.Put("/api/accounts/:id", updateAccount)
 	app.Delete("/api/accounts/:id", deleteAccount)
 	app.Get("/api/notifications", getNotifications)
+	app.Get("/api/accounts/:id/sinks", getAccountSinks)
+	app.Post("/api/accounts/:id/sinks", createAccountSink)
+	app.Put("/api/sinks/:id", updateSink)
+	app.Delete("/api/sinks/:id", deleteSink)
+	app.Get("/api/notifications/:id/body", getNotificationBody)
+	app.Get("/api/notifications/:id/attachments/:aid", getNotificationAttachment)
+	app.Get("/api/notifications/search", searchNotifications)
+	app.Get("/api/accounts/oauth/authorize", oauthAuthorize)
+	app.Post("/api/accounts/oauth/callback", oauthCallback)
+	app.Get("/api/rules", getRules)
+	app.Post("/api/rules", createRule)
+	app.Put("/api/rules/:id", updateRule)
+	app.Delete("/api/rules/:id", deleteRule)
+	app.Post("/api/rules/:id/test", testRule)
+	app.Post("/api/rules/import", importSieveRules)
 
 	// WebSocket endpoint
 	app.Use("/ws", func(c *fiber.Ctx) error {
@@ -114,11 +521,13 @@ func main() {
 		wsClientsMux.Lock()
 		wsClients[c] = true
 		wsClientsMux.Unlock()
+		telemetry.WebsocketClients.Inc()
 
 		defer func() {
 			wsClientsMux.Lock()
 			delete(wsClients, c)
 			wsClientsMux.Unlock()
+			telemetry.WebsocketClients.Dec()
 			c.Close()
 		}()
 
@@ -129,7 +538,7 @@ func main() {
 		for {
 			_, _, err := c.ReadMessage()
 			if err != nil {
-				log.Println("WebSocket read error:", err)
+				slog.Warn("websocket read error", "error", err)
 				break
 			}
 		}
@@ -138,8 +547,11 @@ func main() {
 	// Start email check worker
 	go emailCheckWorker()
 
-	log.Printf("Server starting on :%s", serverPort)
-	log.Fatal(app.Listen(":" + serverPort))
+	slog.Info("server starting", "port", serverPort)
+	if err := app.Listen(":" + serverPort); err != nil {
+		slog.Error("server exited", "error", err)
+		os.Exit(1)
+	}
 }
 
 func getEnv(key, defaultValue string) string {
@@ -149,6 +561,51 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// runKeyRotate re-encrypts every EncryptedString column under the current
+// MASTER_KEY/MASTER_KEY_ID, reading rows under CRYPTO_PREV_KEY_ID/
+// CRYPTO_PREV_KEY (the key being rotated away from) until they're
+// rewritten. Because crypto.Active accepts both keys for decryption for
+// the whole run, the server can keep handling requests against the same
+// database throughout -- there's no moment where rows are unreadable.
+func runKeyRotate(args []string) {
+	fs := flag.NewFlagSet("keyrotate", flag.ExitOnError)
+	batchSize := fs.Int("batch", 200, "rows to re-encrypt per batch")
+	fs.Parse(args)
+
+	ctx := context.Background()
+	if getEnv("CRYPTO_PREV_KEY_ID", "") == "" || getEnv("CRYPTO_PREV_KEY", "") == "" {
+		slog.Error("keyrotate: CRYPTO_PREV_KEY_ID and CRYPTO_PREV_KEY must name the key being rotated away from")
+		os.Exit(1)
+	}
+	initCrypto(ctx)
+
+	var err error
+	db, err = gorm.Open(postgres.Open(dbDSN()), &gorm.Config{})
+	if err != nil {
+		slog.Error("keyrotate: failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+
+	var accounts []EmailAccount
+	result := db.FindInBatches(&accounts, *batchSize, func(tx *gorm.DB, batch int) error {
+		for i := range accounts {
+			// Loading through EncryptedString.Scan already opened each
+			// value under whichever key sealed it; saving it back runs
+			// Value() again, which always seals under the current key.
+			if err := tx.Save(&accounts[i]).Error; err != nil {
+				return err
+			}
+		}
+		slog.Info("keyrotate: re-encrypted batch", "batch", batch, "accounts", len(accounts))
+		return nil
+	})
+	if result.Error != nil {
+		slog.Error("keyrotate failed", "error", result.Error)
+		os.Exit(1)
+	}
+	slog.Info("keyrotate: done", "accounts", result.RowsAffected, "key_id", getEnv("MASTER_KEY_ID", "default"))
+}
+
 func sendInitialData(c *websocket.Conn) {
 	var accounts []EmailAccount
 	db.Find(&accounts)
@@ -175,14 +632,15 @@ func broadcastToClients(msg WSMessage) {
 
 	for client := range wsClients {
 		if err := client.WriteJSON(msg); err != nil {
-			log.Printf("WebSocket write error: %v", err)
+			slog.Warn("websocket write error", "error", err)
+			telemetry.WebsocketBroadcastErrorsTotal.Inc()
 		}
 	}
 }
 
 func getAccounts(c *fiber.Ctx) error {
 	var accounts []EmailAccount
-	db.Find(&accounts)
+	observeDBQuery("find_accounts", func() { db.Find(&accounts) })
 	return c.JSON(accounts)
 }
 
@@ -258,80 +716,827 @@ func deleteAccount(c *fiber.Ctx) error {
 func getNotifications(c *fiber.Ctx) error {
 	var notifications []EmailNotification
 	limit := c.QueryInt("limit", 50)
-	
-	db.Order("received_at DESC").Limit(limit).Find(&notifications)
+
+	observeDBQuery("find_notifications", func() {
+		db.Order("received_at DESC").Limit(limit).Find(&notifications)
+	})
 	return c.JSON(notifications)
 }
 
+func getAccountSinks(c *fiber.Ctx) error {
+	var account EmailAccount
+	if err := db.First(&account, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Account not found"})
+	}
+
+	var sinks []NotificationSink
+	db.Where("account_email = ?", account.Email).Find(&sinks)
+	return c.JSON(sinks)
+}
+
+func createAccountSink(c *fiber.Ctx) error {
+	var account EmailAccount
+	if err := db.First(&account, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Account not found"})
+	}
+
+	sink := new(NotificationSink)
+	if err := c.BodyParser(sink); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	sink.AccountEmail = account.Email
+	if err := validateSinkConfig(sink); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := db.Create(sink).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(sink)
+}
+
+func updateSink(c *fiber.Ctx) error {
+	sink := new(NotificationSink)
+	if err := db.First(sink, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Sink not found"})
+	}
+
+	if err := c.BodyParser(sink); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := validateSinkConfig(sink); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := db.Save(sink).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(sink)
+}
+
+// validateSinkConfig decodes sink's stored Config JSON and builds the
+// matching Notifier, so a malformed config (wrong shape, missing
+// pushPlatform, bad APNs cert path, ...) is rejected at create/update time
+// instead of being discovered later at dispatch time.
+func validateSinkConfig(sink *NotificationSink) error {
+	var cfg notifiers.SinkConfig
+	if err := json.Unmarshal([]byte(sink.Config), &cfg); err != nil {
+		return fmt.Errorf("invalid sink config: %w", err)
+	}
+	cfg.Type = sink.Type
+
+	if _, err := notifiers.Build(cfg); err != nil {
+		return err
+	}
+	return nil
+}
+
+func deleteSink(c *fiber.Ctx) error {
+	if err := db.Delete(&NotificationSink{}, c.Params("id")).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// dispatchNotification fans a newly-stored notification out to every
+// enabled sink configured for its account.
+func dispatchNotification(ctx context.Context, n EmailNotification) {
+	var sinkRows []NotificationSink
+	db.WithContext(ctx).Where("account_email = ? AND enabled = ?", n.AccountEmail, true).Find(&sinkRows)
+	if len(sinkRows) == 0 {
+		return
+	}
+
+	sinks := make([]notifiers.ConfiguredSink, 0, len(sinkRows))
+	for _, row := range sinkRows {
+		var cfg notifiers.SinkConfig
+		if err := json.Unmarshal([]byte(row.Config), &cfg); err != nil {
+			slog.Error("sink has invalid config", "sink_id", row.ID, "error", err)
+			continue
+		}
+		cfg.Type = row.Type
+
+		notifier, err := notifiers.Build(cfg)
+		if err != nil {
+			slog.Error("sink could not be built", "sink_id", row.ID, "error", err)
+			continue
+		}
+		sinks = append(sinks, notifiers.ConfiguredSink{ID: row.ID, Notifier: notifier})
+	}
+
+	dispatcher.Dispatch(ctx, notifiers.Notification{
+		ID:           n.ID,
+		AccountEmail: n.AccountEmail,
+		From:         n.From,
+		Subject:      n.Subject,
+		MessageID:    n.MessageID,
+		ReceivedAt:   n.ReceivedAt,
+	}, sinks)
+}
+
+// setupSearchIndex adds the full-text search column and index that
+// AutoMigrate doesn't know how to express, so it's safe to call on every
+// startup.
+func setupSearchIndex() {
+	db.Exec(`ALTER TABLE email_notifications ADD COLUMN IF NOT EXISTS search_vector tsvector`)
+	db.Exec(`CREATE INDEX IF NOT EXISTS email_notifications_search_idx ON email_notifications USING GIN (search_vector)`)
+}
+
+// observeDBQuery times a single database call and records it as
+// db_query_duration_seconds, labeled by a short logical operation name.
+func observeDBQuery(operation string, fn func()) {
+	start := time.Now()
+	fn()
+	telemetry.DBQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// evaluateRules loads and compiles the account's enabled rules, ordered by
+// priority, and returns the actions of the matching rules in priority order,
+// stopping after the first matching rule that has a "drop" action.
+func evaluateRules(accountID uint, ctx rules.Context) []rules.Action {
+	var rows []Rule
+	observeDBQuery("find_rules", func() {
+		db.Where("account_id = ? AND enabled = ?", accountID, true).Order("priority ASC").Find(&rows)
+	})
+	if len(rows) == 0 {
+		return nil
+	}
+
+	compiled := make([]*rules.CompiledRule, 0, len(rows))
+	for _, row := range rows {
+		cr, err := rules.Compile(row.ID, row.Priority, row.ConditionExpr, row.ActionsJSON)
+		if err != nil {
+			slog.Error("rule failed to compile", "rule_id", row.ID, "error", err)
+			continue
+		}
+		compiled = append(compiled, cr)
+	}
+
+	return rules.Evaluate(compiled, ctx)
+}
+
+// ruleHeaderContext parses a raw RFC822 message just far enough to fill in
+// the rules.Context fields evaluateRules can't get from the IMAP envelope
+// or POP3 RETR response: List-Id and the full header set, for rules that
+// match on "list-id" or an arbitrary header field. A parse failure just
+// leaves both zero-valued rather than blocking filtering.
+func ruleHeaderContext(raw []byte) (listID string, headers map[string]string) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return "", nil
+	}
+	headers = make(map[string]string, len(msg.Header))
+	for k, v := range msg.Header {
+		if len(v) > 0 {
+			headers[strings.ToLower(k)] = v[0]
+		}
+	}
+	return msg.Header.Get("List-Id"), headers
+}
+
+// applyPreInsertActions applies the actions that must be decided before the
+// notification row exists: "drop" (report dropped=true, caller must not
+// insert) and "mark_important" (report important=true so the caller can set
+// Priority before inserting).
+func applyPreInsertActions(actions []rules.Action, notification *EmailNotification) (dropped, important bool) {
+	for _, action := range actions {
+		switch action.Type {
+		case "drop":
+			dropped = true
+		case "mark_important":
+			important = true
+		}
+	}
+	return dropped, important
+}
+
+// applyPostInsertActions applies the actions that need the notification's
+// ID: "tag" and "forward_to".
+func applyPostInsertActions(ctx context.Context, actions []rules.Action, notification EmailNotification) {
+	for _, action := range actions {
+		switch action.Type {
+		case "tag":
+			applyTag(notification.ID, action.Params["name"])
+		case "forward_to":
+			forwardToSink(ctx, notification, action.Params["sink_id"])
+		}
+	}
+}
+
+func applyTag(notificationID uint, name string) {
+	if name == "" {
+		return
+	}
+	var tag Tag
+	if err := db.Where(Tag{Name: name}).FirstOrCreate(&tag).Error; err != nil {
+		slog.Error("failed to create tag", "tag", name, "error", err)
+		return
+	}
+	db.Exec(`INSERT INTO notification_tags (email_notification_id, tag_id) VALUES (?, ?) ON CONFLICT DO NOTHING`,
+		notificationID, tag.ID)
+}
+
+func forwardToSink(ctx context.Context, n EmailNotification, sinkIDStr string) {
+	sinkID, err := strconv.Atoi(sinkIDStr)
+	if err != nil {
+		slog.Warn("forward_to has invalid sink_id", "sink_id", sinkIDStr)
+		return
+	}
+
+	var row NotificationSink
+	if err := db.WithContext(ctx).First(&row, sinkID).Error; err != nil {
+		slog.Warn("forward_to sink not found", "sink_id", sinkID)
+		return
+	}
+
+	var cfg notifiers.SinkConfig
+	if err := json.Unmarshal([]byte(row.Config), &cfg); err != nil {
+		slog.Error("sink has invalid config", "sink_id", row.ID, "error", err)
+		return
+	}
+	cfg.Type = row.Type
+
+	notifier, err := notifiers.Build(cfg)
+	if err != nil {
+		slog.Error("sink could not be built", "sink_id", row.ID, "error", err)
+		return
+	}
+
+	dispatcher.Dispatch(ctx, notifiers.Notification{
+		ID:           n.ID,
+		AccountEmail: n.AccountEmail,
+		From:         n.From,
+		Subject:      n.Subject,
+		MessageID:    n.MessageID,
+		ReceivedAt:   n.ReceivedAt,
+	}, []notifiers.ConfiguredSink{{ID: row.ID, Notifier: notifier}})
+}
+
+// moveIfRequested issues an IMAP MOVE for uid if any action asks for one.
+// POP3 has no equivalent, so callers on that path simply never invoke this.
+func moveIfRequested(c *client.Client, uid uint32, actions []rules.Action) error {
+	for _, action := range actions {
+		if action.Type != "move_imap" {
+			continue
+		}
+		folder := action.Params["folder"]
+		if folder == "" {
+			continue
+		}
+
+		seqset := new(imap.SeqSet)
+		seqset.AddNum(uid)
+		moveClient := move.NewClient(c)
+		if err := moveClient.UidMove(seqset, folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getRules(c *fiber.Ctx) error {
+	var rows []Rule
+	db.Order("priority ASC").Find(&rows)
+	return c.JSON(rows)
+}
+
+func createRule(c *fiber.Ctx) error {
+	rule := new(Rule)
+	if err := c.BodyParser(rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := rules.Compile(0, rule.Priority, rule.ConditionExpr, rule.ActionsJSON); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := db.Create(rule).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rule)
+}
+
+func updateRule(c *fiber.Ctx) error {
+	rule := new(Rule)
+	if err := db.First(rule, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Rule not found"})
+	}
+	if err := c.BodyParser(rule); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if _, err := rules.Compile(rule.ID, rule.Priority, rule.ConditionExpr, rule.ActionsJSON); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	if err := db.Save(rule).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(rule)
+}
+
+func deleteRule(c *fiber.Ctx) error {
+	if err := db.Delete(&Rule{}, c.Params("id")).Error; err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"success": true})
+}
+
+// testRule dry-runs a rule against a notification without applying any
+// actions, so the UI can show what a rule would do before enabling it.
+func testRule(c *fiber.Ctx) error {
+	var rule Rule
+	if err := db.First(&rule, c.Params("id")).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Rule not found"})
+	}
+
+	var notification EmailNotification
+	var req struct {
+		NotificationID uint `json:"notificationId"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := db.First(&notification, req.NotificationID).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Notification not found"})
+	}
+
+	var body EmailBody
+	db.Where("notification_id = ?", notification.ID).First(&body)
+
+	compiled, err := rules.Compile(rule.ID, rule.Priority, rule.ConditionExpr, rule.ActionsJSON)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	ctx := rules.Context{
+		From:    notification.From,
+		Subject: notification.Subject,
+		Body:    body.Plain,
+	}
+	matched := compiled.Condition.Match(ctx)
+
+	result := fiber.Map{"matched": matched}
+	if matched {
+		result["actions"] = compiled.Actions
+	}
+	return c.JSON(result)
+}
+
+func importSieveRules(c *fiber.Ctx) error {
+	var req struct {
+		AccountID uint   `json:"accountId"`
+		Script    string `json:"script"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	imported, err := rules.ParseSieve(req.Script)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	created := make([]Rule, 0, len(imported))
+	for i, r := range imported {
+		rule := Rule{
+			AccountID:     req.AccountID,
+			Priority:      i,
+			ConditionExpr: r.ConditionExpr,
+			ActionsJSON:   r.ActionsJSON,
+		}
+		if err := db.Create(&rule).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+		}
+		created = append(created, rule)
+	}
+
+	return c.JSON(created)
+}
+
+// updateSearchVector (re)computes the tsvector for a notification from its
+// from/subject plus, once it's available, the plain-text body.
+func updateSearchVector(notificationID uint, from, subject, plainBody string) {
+	db.Exec(`UPDATE email_notifications SET search_vector =
+		to_tsvector('english', coalesce(?, '') || ' ' || coalesce(?, '') || ' ' || coalesce(?, ''))
+		WHERE id = ?`, from, subject, plainBody, notificationID)
+}
+
+// storeMessageBody parses a full RFC822 message, persists its text/html
+// parts and attachments, and refreshes the notification's search vector now
+// that the body text is known.
+func storeMessageBody(ctx context.Context, notification EmailNotification, raw []byte) error {
+	mr, err := emmail.CreateReader(bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("parse message: %w", err)
+	}
+
+	var plain, html string
+	var attachments []EmailAttachment
+
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read part: %w", err)
+		}
+
+		switch header := part.Header.(type) {
+		case *emmail.InlineHeader:
+			contentType, _, _ := header.ContentType()
+			body, err := io.ReadAll(part.Body)
+			if err != nil {
+				return fmt.Errorf("read inline part: %w", err)
+			}
+			switch contentType {
+			case "text/plain":
+				plain += string(body)
+			case "text/html":
+				html += string(body)
+			}
+
+		case *emmail.AttachmentHeader:
+			filename, _ := header.Filename()
+			contentType, _, _ := header.ContentType()
+			body, err := io.ReadAll(part.Body)
+			if err != nil {
+				return fmt.Errorf("read attachment: %w", err)
+			}
+
+			sum := sha256.Sum256(body)
+			digest := hex.EncodeToString(sum[:])
+
+			path, err := blobStore.Put(ctx, digest, bytes.NewReader(body))
+			if err != nil {
+				slog.Error("failed to store attachment", "filename", filename, "message_id", notification.MessageID, "error", err)
+				continue
+			}
+
+			attachments = append(attachments, EmailAttachment{
+				NotificationID: notification.ID,
+				Filename:       filename,
+				Mime:           contentType,
+				Size:           len(body),
+				SHA256:         digest,
+				StoragePath:    path,
+			})
+		}
+	}
+
+	snippet := plain
+	if len(snippet) > snippetLen {
+		snippet = snippet[:snippetLen]
+	}
+
+	emailBody := EmailBody{
+		NotificationID: notification.ID,
+		Plain:          plain,
+		HTML:           html,
+		Snippet:        snippet,
+		Size:           len(raw),
+		HasAttachments: len(attachments) > 0,
+	}
+	if err := db.WithContext(ctx).Create(&emailBody).Error; err != nil {
+		return fmt.Errorf("save body: %w", err)
+	}
+
+	for i := range attachments {
+		if err := db.WithContext(ctx).Create(&attachments[i]).Error; err != nil {
+			slog.Error("failed to save attachment metadata", "message_id", notification.MessageID, "error", err)
+		}
+	}
+
+	updateSearchVector(notification.ID, notification.From, notification.Subject, plain)
+	return nil
+}
+
+func getNotificationBody(c *fiber.Ctx) error {
+	var body EmailBody
+	if err := db.Where("notification_id = ?", c.Params("id")).First(&body).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Body not found"})
+	}
+	return c.JSON(body)
+}
+
+func getNotificationAttachment(c *fiber.Ctx) error {
+	var attachment EmailAttachment
+	if err := db.Where("notification_id = ? AND id = ?", c.Params("id"), c.Params("aid")).First(&attachment).Error; err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Attachment not found"})
+	}
+
+	reader, err := blobStore.Get(c.Context(), attachment.StoragePath)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	defer reader.Close()
+
+	c.Set("Content-Type", attachment.Mime)
+	c.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, attachment.Filename))
+	return c.SendStream(reader)
+}
+
+func searchNotifications(c *fiber.Ctx) error {
+	query := c.Query("q")
+	if query == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "q is required"})
+	}
+	limit := c.QueryInt("limit", 50)
+
+	var notifications []EmailNotification
+	db.Raw(`SELECT n.* FROM email_notifications n
+		LEFT JOIN email_bodies b ON b.notification_id = n.id
+		WHERE n.search_vector @@ plainto_tsquery('english', ?)
+		ORDER BY n.received_at DESC LIMIT ?`, query, limit).Scan(&notifications)
+
+	return c.JSON(notifications)
+}
+
+// emailCheckWorker supervises long-lived per-account workers. IMAP accounts
+// get a persistent IDLE connection via runIMAPWorker; POP3 has no IDLE
+// equivalent so it keeps the original poll-on-a-ticker model. The supervisor
+// re-scans periodically so accounts added or re-activated after startup are
+// picked up without a restart.
 func emailCheckWorker() {
-	ticker := time.NewTicker(checkInterval)
-	defer ticker.Stop()
+	started := make(map[uint]bool)
+	var startedMux sync.Mutex
 
-	for range ticker.C {
+	scan := func() {
 		var accounts []EmailAccount
 		db.Where("is_active = ?", true).Find(&accounts)
 
+		startedMux.Lock()
+		defer startedMux.Unlock()
 		for _, account := range accounts {
-			go checkEmail(account)
+			if started[account.ID] {
+				continue
+			}
+			started[account.ID] = true
+
+			account := account
+			switch account.Protocol {
+			case "IMAP":
+				go runIMAPWorker(account)
+			case "POP3":
+				go runPOP3Worker(account)
+			}
 		}
 	}
+
+	scan()
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		scan()
+	}
 }
 
-func checkEmail(account EmailAccount) {
-	log.Printf("Checking email for %s", account.Email)
+func runPOP3Worker(account EmailAccount) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
 
-	if account.Protocol == "IMAP" {
-		checkIMAP(account)
-	} else if account.Protocol == "POP3" {
+	for ; ; <-ticker.C {
 		checkPOP3(account)
+		account.LastCheck = time.Now()
+		db.Save(&account)
 	}
+}
 
-	account.LastCheck = time.Now()
-	db.Save(&account)
+// runIMAPWorker keeps one authenticated IMAP connection open for the
+// lifetime of the process and uses IDLE to learn about new messages as soon
+// as the server reports them, instead of polling. If the server doesn't
+// advertise IDLE, it polls on checkInterval over the same connection; if the
+// connection drops, it reconnects on an exponential backoff.
+func runIMAPWorker(account EmailAccount) {
+	backoff := time.Second
+
+	for {
+		if err := imapSession(&account); err != nil {
+			slog.Warn("imap session ended, retrying", "account", account.Email, "error", err, "backoff", backoff)
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > maxReconnectBackoff {
+				backoff = maxReconnectBackoff
+			}
+			continue
+		}
+		backoff = time.Second
+	}
 }
 
-func checkIMAP(account EmailAccount) {
-	c, err := client.DialTLS(fmt.Sprintf("%s:%d", account.Host, account.Port), &tls.Config{
-		InsecureSkipVerify: true,
-	})
+// tlsConfigFor builds the TLS config used to dial an account's IMAP/POP3
+// server: normal chain validation against the system root CAs (no custom
+// RootCAs needed -- that's Go's default when the field is nil), plus, if
+// the account has a pinned certificate fingerprint, a check that rejects
+// any leaf certificate not matching it.
+func tlsConfigFor(account *EmailAccount) *tls.Config {
+	cfg := &tls.Config{ServerName: account.Host}
+	if account.CertFingerprint == "" {
+		return cfg
+	}
+
+	pinned := strings.ToLower(strings.ReplaceAll(account.CertFingerprint, ":", ""))
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("no peer certificate presented")
+		}
+		sum := sha256.Sum256(rawCerts[0])
+		if hex.EncodeToString(sum[:]) != pinned {
+			return fmt.Errorf("certificate fingerprint mismatch for %s", account.Host)
+		}
+		return nil
+	}
+	return cfg
+}
+
+// imapSession dials, logs in, and serves one account until the connection is
+// lost or an unrecoverable error occurs. A non-nil return means the caller
+// should reconnect.
+func imapSession(account *EmailAccount) error {
+	c, err := dialIMAP(account)
 	if err != nil {
-		log.Printf("Failed to connect to IMAP server for %s: %v", account.Email, err)
-		return
+		return err
 	}
 	defer c.Logout()
 
-	if err := c.Login(account.Email, account.Password); err != nil {
-		log.Printf("Failed to login for %s: %v", account.Email, err)
-		return
+	if err := syncNewMessages(c, account); err != nil {
+		slog.Error("initial sync failed", "account", account.Email, "error", err)
 	}
+	account.LastCheck = time.Now()
+	db.Save(account)
 
-	mbox, err := c.Select("INBOX", false)
+	supportsIdle, err := c.Support("IDLE")
 	if err != nil {
-		log.Printf("Failed to select INBOX for %s: %v", account.Email, err)
-		return
+		return fmt.Errorf("checking IDLE support: %w", err)
+	}
+	if !supportsIdle {
+		slog.Info("server does not advertise IDLE, falling back to polling", "account", account.Email)
+		return pollLoop(c, account)
 	}
 
-	if mbox.Messages == 0 {
-		return
+	return idleLoop(c, account)
+}
+
+// dialIMAP opens and authenticates an IMAP connection, tracing the dial,
+// login, and INBOX select under a single "imap.connect" span so connection
+// and auth failures show up in tracing the same way checkPOP3's dial does.
+func dialIMAP(account *EmailAccount) (*client.Client, error) {
+	_, span := telemetry.StartSpan(context.Background(), "imap.connect",
+		attribute.String("account", account.Email))
+	defer span.End()
+
+	c, err := client.DialTLS(fmt.Sprintf("%s:%d", account.Host, account.Port), tlsConfigFor(account))
+	if err != nil {
+		span.RecordError(err)
+		return nil, fmt.Errorf("dial: %w", err)
+	}
+
+	if err := imapAuthenticate(c, account); err != nil {
+		span.RecordError(err)
+		c.Logout()
+		return nil, fmt.Errorf("login: %w", err)
+	}
+
+	if _, err := c.Select("INBOX", false); err != nil {
+		span.RecordError(err)
+		c.Logout()
+		return nil, fmt.Errorf("select INBOX: %w", err)
+	}
+
+	return c, nil
+}
+
+// idleLoop issues IMAP IDLE and re-issues it every idleTimeout. When the
+// server pushes a mailbox update (EXISTS) in between, it ends the IDLE right
+// away and resyncs; EXPUNGE updates do not trigger a resync.
+func idleLoop(c *client.Client, account *EmailAccount) error {
+	idleClient := idle.NewClient(c)
+
+	updates := make(chan client.Update, 8)
+	c.Updates = updates
+	defer func() { c.Updates = nil }()
+
+	for {
+		stop := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- idleClient.IdleWithFallback(stop, idleTimeout)
+		}()
+
+		resync := false
+	waitForUpdate:
+		for {
+			select {
+			case update := <-updates:
+				switch update.(type) {
+				case *client.MailboxUpdate:
+					resync = true
+					close(stop)
+					if err := <-done; err != nil {
+						return fmt.Errorf("idle: %w", err)
+					}
+					break waitForUpdate
+				}
+			case err := <-done:
+				if err != nil {
+					return fmt.Errorf("idle: %w", err)
+				}
+				break waitForUpdate
+			case <-time.After(idleTimeout):
+				close(stop)
+				<-done
+				break waitForUpdate
+			}
+		}
+
+		if resync {
+			if err := syncNewMessages(c, account); err != nil {
+				return fmt.Errorf("resync: %w", err)
+			}
+			account.LastCheck = time.Now()
+			db.Save(account)
+		}
+	}
+}
+
+// pollLoop is used only for servers that don't support IDLE.
+func pollLoop(c *client.Client, account *EmailAccount) error {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := syncNewMessages(c, account); err != nil {
+			return fmt.Errorf("poll: %w", err)
+		}
+		account.LastCheck = time.Now()
+		db.Save(account)
 	}
+	return nil
+}
+
+// syncNewMessages times and traces one IMAP check and delegates the actual
+// work to syncNewMessagesOnce, recording email_check_duration_seconds/
+// email_check_total under protocol "imap".
+func syncNewMessages(c *client.Client, account *EmailAccount) error {
+	ctx, span := telemetry.StartSpan(context.Background(), "imap.check",
+		attribute.String("account", account.Email))
+	defer span.End()
+
+	start := time.Now()
+	err := syncNewMessagesOnce(ctx, c, account)
 
-	from := uint32(1)
-	to := mbox.Messages
-	if mbox.Messages > 10 {
-		from = mbox.Messages - 9
+	result := "ok"
+	if err != nil {
+		result = "error"
+		span.RecordError(err)
 	}
+	telemetry.CheckDuration.WithLabelValues(account.Email, "imap", result).Observe(time.Since(start).Seconds())
+	telemetry.CheckTotal.WithLabelValues(account.Email, result).Inc()
+	return err
+}
 
-	seqset := new(imap.SeqSet)
-	seqset.AddRange(from, to)
+// syncNewMessagesOnce fetches everything after the highest UID we've seen
+// so far, persists new notifications, and advances account.LastUID. On the
+// very first sync for an account (LastUID == 0) it seeds from the tail of
+// the mailbox instead of fetching the whole history.
+func syncNewMessagesOnce(ctx context.Context, c *client.Client, account *EmailAccount) error {
+	mbox := c.Mailbox()
+	if mbox == nil || mbox.Messages == 0 {
+		return nil
+	}
 
 	messages := make(chan *imap.Message, 10)
 	done := make(chan error, 1)
-	go func() {
-		done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchEnvelope, imap.FetchUid}, messages)
-	}()
+	firstSync := account.LastUID == 0
+
+	if firstSync {
+		// No high-water mark yet: seed one from the tail of the mailbox
+		// instead of fetching (and notifying on) the whole history.
+		seqset := new(imap.SeqSet)
+		from := uint32(1)
+		if mbox.Messages > 10 {
+			from = mbox.Messages - 9
+		}
+		seqset.AddRange(from, mbox.Messages)
+		go func() {
+			done <- c.Fetch(seqset, []imap.FetchItem{imap.FetchUid}, messages)
+		}()
+	} else {
+		seqset := new(imap.SeqSet)
+		seqset.AddRange(account.LastUID+1, 0) // 0 means "*" (no upper bound)
+		go func() {
+			done <- c.UidFetch(seqset, []imap.FetchItem{
+				imap.FetchEnvelope, imap.FetchUid, imap.FetchInternalDate, imapBodySection.FetchItem(),
+			}, messages)
+		}()
+	}
 
+	var highestUID uint32
 	for msg := range messages {
-		if msg.Envelope == nil {
+		if msg.Uid > highestUID {
+			highestUID = msg.Uid
+		}
+
+		if firstSync || msg.Envelope == nil {
 			continue
 		}
 
@@ -347,83 +1552,179 @@ func checkIMAP(account EmailAccount) {
 		subject := msg.Envelope.Subject
 		messageID := msg.Envelope.MessageId
 		receivedAt := msg.Envelope.Date
+		if receivedAt.IsZero() && !msg.InternalDate.IsZero() {
+			receivedAt = msg.InternalDate
+		}
 
 		var existing EmailNotification
-		result := db.Where("message_id = ?", messageID).First(&existing)
-		
-		if result.Error == gorm.ErrRecordNotFound {
-			notification := EmailNotification{
-				AccountEmail: account.Email,
-				From:         fromAddr,
-				Subject:      subject,
-				MessageID:    messageID,
-				ReceivedAt:   receivedAt,
-			}
-			
-			if err := db.Create(&notification).Error; err != nil {
-				log.Printf("Failed to save notification: %v", err)
+		var result *gorm.DB
+		observeDBQuery("find_notification_by_message_id", func() {
+			result = db.WithContext(ctx).Where("message_id = ?", messageID).First(&existing)
+		})
+		if result.Error != gorm.ErrRecordNotFound {
+			continue
+		}
+
+		var raw []byte
+		if body := msg.GetBody(imapBodySection); body != nil {
+			if b, err := io.ReadAll(body); err != nil {
+				slog.Error("failed to read body", "message_id", messageID, "error", err)
 			} else {
-				log.Printf("New email: %s - %s", fromAddr, subject)
-				// Broadcast new notification via WebSocket
-				broadcastToClients(WSMessage{
-					Type:  "new_notification",
-					Notif: &notification,
-				})
+				raw = b
+			}
+		}
+
+		toAddr := ""
+		if len(msg.Envelope.To) > 0 {
+			toAddr = fmt.Sprintf("%s@%s", msg.Envelope.To[0].MailboxName, msg.Envelope.To[0].HostName)
+		}
+
+		notification := EmailNotification{
+			AccountEmail: account.Email,
+			From:         fromAddr,
+			Subject:      subject,
+			MessageID:    messageID,
+			ReceivedAt:   receivedAt,
+		}
+
+		listID, headers := ruleHeaderContext(raw)
+		actions := evaluateRules(account.ID, rules.Context{
+			From:    fromAddr,
+			To:      toAddr,
+			Subject: subject,
+			Body:    string(raw),
+			Size:    len(raw),
+			ListID:  listID,
+			Headers: headers,
+		})
+
+		if dropped, important := applyPreInsertActions(actions, &notification); dropped {
+			slog.Info("rule dropped message", "message_id", messageID, "account", account.Email)
+			if err := moveIfRequested(c, msg.Uid, actions); err != nil {
+				slog.Error("rule move_imap failed", "message_id", messageID, "error", err)
+			}
+			continue
+		} else if important {
+			notification.Priority = 1
+		}
+
+		if err := db.WithContext(ctx).Create(&notification).Error; err != nil {
+			slog.Error("failed to save notification", "error", err)
+			continue
+		}
+
+		slog.Info("new email", "from", fromAddr, "subject", subject)
+		telemetry.EmailsNewTotal.WithLabelValues(account.Email).Inc()
+		broadcastToClients(WSMessage{
+			Type:  "new_notification",
+			Notif: &notification,
+		})
+		dispatchNotification(ctx, notification)
+		updateSearchVector(notification.ID, notification.From, notification.Subject, "")
+		applyPostInsertActions(ctx, actions, notification)
+
+		if err := moveIfRequested(c, msg.Uid, actions); err != nil {
+			slog.Error("rule move_imap failed", "message_id", messageID, "error", err)
+		}
+
+		if len(raw) > 0 {
+			if err := storeMessageBody(ctx, notification, raw); err != nil {
+				slog.Error("failed to store body", "message_id", messageID, "error", err)
 			}
 		}
 	}
 
 	if err := <-done; err != nil {
-		log.Printf("Fetch error for %s: %v", account.Email, err)
+		return fmt.Errorf("uid fetch: %w", err)
+	}
+
+	if highestUID > account.LastUID {
+		account.LastUID = highestUID
+		db.Model(account).Update("last_uid", highestUID)
 	}
+
+	return nil
 }
 
+// checkPOP3 times and traces one POP3 check and delegates the actual work
+// to checkPOP3Once, recording email_check_duration_seconds/
+// email_check_total under protocol "pop3".
 func checkPOP3(account EmailAccount) {
-	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", account.Host, account.Port), 
-		&tls.Config{InsecureSkipVerify: true})
+	ctx, span := telemetry.StartSpan(context.Background(), "pop3.check",
+		attribute.String("account", account.Email))
+	defer span.End()
+
+	start := time.Now()
+	err := checkPOP3Once(ctx, account)
+
+	result := "ok"
 	if err != nil {
-		log.Printf("Failed to connect to POP3 server for %s: %v", account.Email, err)
-		return
+		result = "error"
+		span.RecordError(err)
+		slog.Error("pop3 check failed", "account", account.Email, "error", err)
+	}
+	telemetry.CheckDuration.WithLabelValues(account.Email, "pop3", result).Observe(time.Since(start).Seconds())
+	telemetry.CheckTotal.WithLabelValues(account.Email, result).Inc()
+}
+
+func checkPOP3Once(ctx context.Context, account EmailAccount) error {
+	conn, err := tls.Dial("tcp", fmt.Sprintf("%s:%d", account.Host, account.Port), tlsConfigFor(&account))
+	if err != nil {
+		return fmt.Errorf("connect: %w", err)
 	}
 	defer conn.Close()
 
 	reader := bufio.NewReader(conn)
-	
+
 	_, err = reader.ReadString('\n')
 	if err != nil {
-		log.Printf("Failed to read welcome for %s: %v", account.Email, err)
-		return
+		return fmt.Errorf("read welcome: %w", err)
 	}
 
-	fmt.Fprintf(conn, "USER %s\r\n", account.Email)
-	response, _ := reader.ReadString('\n')
-	if !strings.HasPrefix(response, "+OK") {
-		log.Printf("POP3 USER failed for %s: %s", account.Email, response)
-		return
-	}
+	var response string
+	if account.AuthType == "xoauth2" {
+		if err := ensureFreshToken(&account); err != nil {
+			return fmt.Errorf("token refresh: %w", err)
+		}
+		authStr := base64.StdEncoding.EncodeToString(
+			[]byte("user=" + account.Email + "\x01auth=Bearer " + account.AccessToken + "\x01\x01"))
+		fmt.Fprintf(conn, "AUTH XOAUTH2 %s\r\n", authStr)
+		response, _ = reader.ReadString('\n')
+		if !strings.HasPrefix(response, "+OK") {
+			return fmt.Errorf("xoauth2 failed: %s", strings.TrimSpace(response))
+		}
+	} else {
+		fmt.Fprintf(conn, "USER %s\r\n", account.Email)
+		response, _ = reader.ReadString('\n')
+		if !strings.HasPrefix(response, "+OK") {
+			return fmt.Errorf("user failed: %s", strings.TrimSpace(response))
+		}
 
-	fmt.Fprintf(conn, "PASS %s\r\n", account.Password)
-	response, _ = reader.ReadString('\n')
-	if !strings.HasPrefix(response, "+OK") {
-		log.Printf("POP3 PASS failed for %s: %s", account.Email, response)
-		return
+		fmt.Fprintf(conn, "PASS %s\r\n", string(account.Password))
+		response, _ = reader.ReadString('\n')
+		if !strings.HasPrefix(response, "+OK") {
+			return fmt.Errorf("pass failed: %s", strings.TrimSpace(response))
+		}
 	}
 
 	fmt.Fprintf(conn, "STAT\r\n")
 	response, _ = reader.ReadString('\n')
 	if !strings.HasPrefix(response, "+OK") {
-		log.Printf("POP3 STAT failed for %s: %s", account.Email, response)
-		return
+		return fmt.Errorf("stat failed: %s", strings.TrimSpace(response))
 	}
 
 	parts := strings.Fields(response)
 	if len(parts) < 2 {
-		return
+		return fmt.Errorf("malformed stat response: %s", strings.TrimSpace(response))
 	}
-	
+
 	count, err := strconv.Atoi(parts[1])
-	if err != nil || count == 0 {
-		return
+	if err != nil {
+		return fmt.Errorf("parse stat count: %w", err)
+	}
+	if count == 0 {
+		fmt.Fprintf(conn, "QUIT\r\n")
+		return nil
 	}
 
 	start := 1
@@ -432,24 +1733,24 @@ func checkPOP3(account EmailAccount) {
 	}
 
 	for i := start; i <= count; i++ {
-		fmt.Fprintf(conn, "TOP %d 0\r\n", i)
+		fmt.Fprintf(conn, "RETR %d\r\n", i)
 		response, _ = reader.ReadString('\n')
 		if !strings.HasPrefix(response, "+OK") {
 			continue
 		}
 
-		var headers strings.Builder
+		var raw strings.Builder
 		for {
 			line, err := reader.ReadString('\n')
 			if err != nil || line == ".\r\n" || line == ".\n" {
 				break
 			}
-			headers.WriteString(line)
+			raw.WriteString(strings.TrimPrefix(line, "."))
 		}
 
-		emailMsg, err := mail.ReadMessage(strings.NewReader(headers.String()))
+		emailMsg, err := mail.ReadMessage(strings.NewReader(raw.String()))
 		if err != nil {
-			log.Printf("Failed to parse message %d for %s: %v", i, account.Email, err)
+			slog.Error("failed to parse pop3 message", "index", i, "account", account.Email, "error", err)
 			continue
 		}
 
@@ -470,29 +1771,61 @@ func checkPOP3(account EmailAccount) {
 		}
 
 		var existing EmailNotification
-		result := db.Where("message_id = ?", messageID).First(&existing)
-		
-		if result.Error == gorm.ErrRecordNotFound {
-			notification := EmailNotification{
-				AccountEmail: account.Email,
-				From:         from,
-				Subject:      subject,
-				MessageID:    messageID,
-				ReceivedAt:   receivedAt,
-			}
-			
-			if err := db.Create(&notification).Error; err != nil {
-				log.Printf("Failed to save notification: %v", err)
-			} else {
-				log.Printf("New email: %s - %s", from, subject)
-				// Broadcast new notification via WebSocket
-				broadcastToClients(WSMessage{
-					Type:  "new_notification",
-					Notif: &notification,
-				})
-			}
+		var result *gorm.DB
+		observeDBQuery("find_notification_by_message_id", func() {
+			result = db.WithContext(ctx).Where("message_id = ?", messageID).First(&existing)
+		})
+		if result.Error != gorm.ErrRecordNotFound {
+			continue
+		}
+
+		rawBytes := []byte(raw.String())
+		notification := EmailNotification{
+			AccountEmail: account.Email,
+			From:         from,
+			Subject:      subject,
+			MessageID:    messageID,
+			ReceivedAt:   receivedAt,
+		}
+
+		listID, headers := ruleHeaderContext(rawBytes)
+		actions := evaluateRules(account.ID, rules.Context{
+			From:    from,
+			Subject: subject,
+			Body:    raw.String(),
+			Size:    len(rawBytes),
+			ListID:  listID,
+			Headers: headers,
+		})
+
+		if dropped, important := applyPreInsertActions(actions, &notification); dropped {
+			slog.Info("rule dropped pop3 message", "message_id", messageID, "account", account.Email)
+			continue
+		} else if important {
+			notification.Priority = 1
+		}
+
+		if err := db.WithContext(ctx).Create(&notification).Error; err != nil {
+			slog.Error("failed to save notification", "error", err)
+			continue
+		}
+
+		slog.Info("new email", "from", from, "subject", subject)
+		telemetry.EmailsNewTotal.WithLabelValues(account.Email).Inc()
+		// Broadcast new notification via WebSocket
+		broadcastToClients(WSMessage{
+			Type:  "new_notification",
+			Notif: &notification,
+		})
+		dispatchNotification(ctx, notification)
+		updateSearchVector(notification.ID, notification.From, notification.Subject, "")
+		applyPostInsertActions(ctx, actions, notification)
+
+		if err := storeMessageBody(ctx, notification, rawBytes); err != nil {
+			slog.Error("failed to store body", "message_id", notification.MessageID, "error", err)
 		}
 	}
 
 	fmt.Fprintf(conn, "QUIT\r\n")
-}
\ No newline at end of file
+	return nil
+}
@@ -0,0 +1,62 @@
+package notifiers
+
+import (
+	"context"
+	"time"
+)
+
+// ConfiguredSink pairs a built Notifier with the ID of the NotificationSink
+// row it came from, so failures can be attributed back to it.
+type ConfiguredSink struct {
+	ID       uint
+	Notifier Notifier
+}
+
+// Dispatcher fans a notification out to a set of sinks concurrently,
+// retrying each sink independently with bounded exponential backoff before
+// giving up and reporting the failure via OnFailure.
+type Dispatcher struct {
+	MaxAttempts int
+	BaseBackoff time.Duration
+
+	// OnFailure is invoked once a sink has exhausted MaxAttempts. Callers
+	// typically use it to persist a dead-letter row.
+	OnFailure func(sink ConfiguredSink, n Notification, err error, attempts int)
+}
+
+// NewDispatcher returns a Dispatcher with sane retry defaults.
+func NewDispatcher() *Dispatcher {
+	return &Dispatcher{
+		MaxAttempts: 5,
+		BaseBackoff: 2 * time.Second,
+	}
+}
+
+// Dispatch delivers n to every sink concurrently. It does not block on
+// delivery completing.
+func (d *Dispatcher) Dispatch(ctx context.Context, n Notification, sinks []ConfiguredSink) {
+	for _, sink := range sinks {
+		sink := sink
+		go d.deliver(ctx, sink, n)
+	}
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, sink ConfiguredSink, n Notification) {
+	backoff := d.BaseBackoff
+	var lastErr error
+
+	for attempt := 1; attempt <= d.MaxAttempts; attempt++ {
+		lastErr = sink.Notifier.Notify(ctx, n)
+		if lastErr == nil {
+			return
+		}
+		if attempt < d.MaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	if d.OnFailure != nil {
+		d.OnFailure(sink, n, lastErr, d.MaxAttempts)
+	}
+}
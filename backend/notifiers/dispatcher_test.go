@@ -0,0 +1,70 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type stubNotifier struct {
+	attempts int32
+	err      error
+}
+
+func (s *stubNotifier) Notify(ctx context.Context, n Notification) error {
+	atomic.AddInt32(&s.attempts, 1)
+	return s.err
+}
+
+func TestDeliverGivesUpAfterMaxAttemptsAndCallsOnFailureOnce(t *testing.T) {
+	notifier := &stubNotifier{err: errors.New("destination unreachable")}
+	sink := ConfiguredSink{ID: 1, Notifier: notifier}
+
+	var failures int32
+	var lastAttempts int
+	d := &Dispatcher{
+		MaxAttempts: 3,
+		BaseBackoff: time.Millisecond,
+		OnFailure: func(s ConfiguredSink, n Notification, err error, attempts int) {
+			atomic.AddInt32(&failures, 1)
+			lastAttempts = attempts
+		},
+	}
+
+	d.deliver(context.Background(), sink, Notification{ID: 42})
+
+	if got := atomic.LoadInt32(&notifier.attempts); got != int32(d.MaxAttempts) {
+		t.Errorf("Notify called %d times, want %d", got, d.MaxAttempts)
+	}
+	if got := atomic.LoadInt32(&failures); got != 1 {
+		t.Errorf("OnFailure called %d times, want exactly once", got)
+	}
+	if lastAttempts != d.MaxAttempts {
+		t.Errorf("OnFailure reported attempts=%d, want %d", lastAttempts, d.MaxAttempts)
+	}
+}
+
+func TestDeliverSucceedsWithoutExhaustingAttemptsOrCallingOnFailure(t *testing.T) {
+	notifier := &stubNotifier{err: nil}
+	sink := ConfiguredSink{ID: 1, Notifier: notifier}
+
+	var failures int32
+	d := &Dispatcher{
+		MaxAttempts: 5,
+		BaseBackoff: time.Millisecond,
+		OnFailure: func(s ConfiguredSink, n Notification, err error, attempts int) {
+			atomic.AddInt32(&failures, 1)
+		},
+	}
+
+	d.deliver(context.Background(), sink, Notification{ID: 42})
+
+	if got := atomic.LoadInt32(&notifier.attempts); got != 1 {
+		t.Errorf("Notify called %d times, want 1 on first-try success", got)
+	}
+	if got := atomic.LoadInt32(&failures); got != 0 {
+		t.Errorf("OnFailure called %d times, want 0 on success", got)
+	}
+}
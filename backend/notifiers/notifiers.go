@@ -0,0 +1,72 @@
+// Package notifiers fans a single new-mail event out to any number of
+// configured delivery sinks (webhooks, SMTP forwarding, mobile push, ...).
+package notifiers
+
+import (
+	"context"
+	"time"
+)
+
+// Notification is the sink-facing view of a new message. It is deliberately
+// decoupled from the GORM EmailNotification model so this package doesn't
+// need to import package main.
+type Notification struct {
+	ID           uint      `json:"id"`
+	AccountEmail string    `json:"accountEmail"`
+	From         string    `json:"from"`
+	Subject      string    `json:"subject"`
+	MessageID    string    `json:"messageId"`
+	ReceivedAt   time.Time `json:"receivedAt"`
+}
+
+// Notifier delivers a notification to one external destination.
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// SinkConfig is the persisted, type-specific configuration for a sink, as
+// stored in NotificationSink.Config. Build* constructs the matching Notifier.
+type SinkConfig struct {
+	Type string `json:"type"`
+
+	// webhook
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Secret  string            `json:"secret,omitempty"`
+
+	// smtp
+	SMTPHost string `json:"smtpHost,omitempty"`
+	SMTPPort int    `json:"smtpPort,omitempty"`
+	SMTPUser string `json:"smtpUser,omitempty"`
+	SMTPPass string `json:"smtpPass,omitempty"`
+	MailTo   string `json:"mailTo,omitempty"`
+	MailFrom string `json:"mailFrom,omitempty"`
+
+	// push
+	PushPlatform string `json:"pushPlatform,omitempty"` // "fcm" | "apns"
+	PushToken    string `json:"pushToken,omitempty"`
+	FCMServerKey string `json:"fcmServerKey,omitempty"`
+	APNSCertPath string `json:"apnsCertPath,omitempty"`
+	APNSKeyPath  string `json:"apnsKeyPath,omitempty"`
+	APNSTopic    string `json:"apnsTopic,omitempty"`
+}
+
+// Build constructs the Notifier described by the config.
+func Build(cfg SinkConfig) (Notifier, error) {
+	switch cfg.Type {
+	case "webhook":
+		return NewWebhookSink(cfg), nil
+	case "smtp":
+		return NewSMTPSink(cfg), nil
+	case "push":
+		return NewPushSink(cfg)
+	default:
+		return nil, errUnknownSinkType(cfg.Type)
+	}
+}
+
+type errUnknownSinkType string
+
+func (e errUnknownSinkType) Error() string {
+	return "notifiers: unknown sink type " + string(e)
+}
@@ -0,0 +1,128 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// PushSink delivers a mobile push notification over either FCM (Android,
+// legacy HTTP key-based API) or APNs (iOS, certificate-based provider API).
+type PushSink struct {
+	platform string
+	token    string
+
+	// fcm
+	fcmServerKey string
+
+	// apns
+	apnsTopic string
+	client    *http.Client
+}
+
+func NewPushSink(cfg SinkConfig) (*PushSink, error) {
+	p := &PushSink{
+		platform:     cfg.PushPlatform,
+		token:        cfg.PushToken,
+		fcmServerKey: cfg.FCMServerKey,
+		apnsTopic:    cfg.APNSTopic,
+	}
+
+	switch cfg.PushPlatform {
+	case "fcm":
+		p.client = &http.Client{Timeout: 10 * time.Second}
+	case "apns":
+		cert, err := tls.LoadX509KeyPair(cfg.APNSCertPath, cfg.APNSKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("load APNs certificate: %w", err)
+		}
+		p.client = &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+			},
+		}
+	default:
+		return nil, fmt.Errorf("unsupported push platform %q", cfg.PushPlatform)
+	}
+
+	return p, nil
+}
+
+func (p *PushSink) Notify(ctx context.Context, n Notification) error {
+	switch p.platform {
+	case "fcm":
+		return p.notifyFCM(ctx, n)
+	case "apns":
+		return p.notifyAPNS(ctx, n)
+	default:
+		return fmt.Errorf("unsupported push platform %q", p.platform)
+	}
+}
+
+func (p *PushSink) notifyFCM(ctx context.Context, n Notification) error {
+	payload := map[string]any{
+		"to": p.token,
+		"notification": map[string]string{
+			"title": n.AccountEmail,
+			"body":  fmt.Sprintf("%s: %s", n.From, n.Subject),
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://fcm.googleapis.com/fcm/send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "key="+p.fcmServerKey)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("fcm request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("fcm returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (p *PushSink) notifyAPNS(ctx context.Context, n Notification) error {
+	payload := map[string]any{
+		"aps": map[string]any{
+			"alert": map[string]string{
+				"title": n.AccountEmail,
+				"body":  fmt.Sprintf("%s: %s", n.From, n.Subject),
+			},
+		},
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	url := fmt.Sprintf("https://api.push.apple.com/3/device/%s", p.token)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("apns-topic", p.apnsTopic)
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("apns request: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("apns returned status %d", resp.StatusCode)
+	}
+	return nil
+}
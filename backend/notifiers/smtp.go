@@ -0,0 +1,61 @@
+package notifiers
+
+import (
+	"context"
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// SMTPSink re-sends a short summary of the notification to a configured
+// address via a regular SMTP relay.
+type SMTPSink struct {
+	host string
+	port int
+	user string
+	pass string
+	from string
+	to   string
+}
+
+func NewSMTPSink(cfg SinkConfig) *SMTPSink {
+	return &SMTPSink{
+		host: cfg.SMTPHost,
+		port: cfg.SMTPPort,
+		user: cfg.SMTPUser,
+		pass: cfg.SMTPPass,
+		from: cfg.MailFrom,
+		to:   cfg.MailTo,
+	}
+}
+
+func (s *SMTPSink) Notify(ctx context.Context, n Notification) error {
+	addr := fmt.Sprintf("%s:%d", s.host, s.port)
+
+	var auth smtp.Auth
+	if s.user != "" {
+		auth = smtp.PlainAuth("", s.user, s.pass, s.host)
+	}
+
+	subject := stripCRLF(n.Subject)
+	from := stripCRLF(n.From)
+
+	msg := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: New mail for %s: %s\r\n\r\n"+
+		"New message received for %s\r\nFrom: %s\r\nSubject: %s\r\nReceived: %s\r\n",
+		s.from, s.to, n.AccountEmail, subject,
+		n.AccountEmail, from, subject, n.ReceivedAt)
+
+	if err := smtp.SendMail(addr, auth, s.from, []string{s.to}, []byte(msg)); err != nil {
+		return fmt.Errorf("smtp send: %w", err)
+	}
+	return nil
+}
+
+// stripCRLF removes CR and LF from a value taken from a remote message
+// (From/Subject) before it's interpolated into a raw header block, so a
+// crafted incoming header can't inject additional SMTP headers or body
+// content into the forwarded notification.
+func stripCRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r", "")
+	return strings.ReplaceAll(s, "\n", "")
+}
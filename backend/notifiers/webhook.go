@@ -0,0 +1,68 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookSink POSTs the notification as JSON to a configured URL. If a
+// secret is configured, the body is signed with HMAC-SHA256 and sent in the
+// X-Signature-256 header so receivers can verify authenticity.
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	secret  string
+	client  *http.Client
+}
+
+func NewWebhookSink(cfg SinkConfig) *WebhookSink {
+	return &WebhookSink{
+		url:     cfg.URL,
+		headers: cfg.Headers,
+		secret:  cfg.Secret,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (w *WebhookSink) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("marshal notification: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range w.headers {
+		req.Header.Set(k, v)
+	}
+	if w.secret != "" {
+		req.Header.Set("X-Signature-256", "sha256="+signHMAC(w.secret, body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func signHMAC(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,21 @@
+package notifiers
+
+import "testing"
+
+func TestSignHMACIsDeterministicAndSecretDependent(t *testing.T) {
+	body := []byte(`{"subject":"hi"}`)
+
+	sig1 := signHMAC("secret-a", body)
+	sig2 := signHMAC("secret-a", body)
+	if sig1 != sig2 {
+		t.Errorf("signHMAC is not deterministic: %q != %q", sig1, sig2)
+	}
+
+	if sig3 := signHMAC("secret-b", body); sig3 == sig1 {
+		t.Error("signHMAC produced the same signature for two different secrets")
+	}
+
+	if other := signHMAC("secret-a", []byte(`{"subject":"bye"}`)); other == sig1 {
+		t.Error("signHMAC produced the same signature for two different bodies")
+	}
+}
@@ -0,0 +1,230 @@
+// Package rules implements a small condition/action engine for filtering
+// incoming mail, similar in spirit to Sieve but expressed as JSON so it can
+// be edited through the REST API without a script parser on the hot path.
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Context is everything a condition can match against for one message.
+type Context struct {
+	From    string
+	To      string
+	Subject string
+	Body    string
+	Size    int
+	ListID  string
+	Headers map[string]string // header name (lowercased) -> raw value
+}
+
+// Condition is a single predicate, or a boolean combination of others.
+type Condition interface {
+	Match(ctx Context) bool
+}
+
+// field/op leaf condition, e.g. {"field": "subject", "op": "contains", "value": "invoice"}.
+type fieldCondition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+	Regex *regexp.Regexp
+}
+
+func (c *fieldCondition) Match(ctx Context) bool {
+	var actual string
+	switch strings.ToLower(c.Field) {
+	case "from":
+		actual = ctx.From
+	case "to":
+		actual = ctx.To
+	case "subject":
+		actual = ctx.Subject
+	case "body":
+		actual = ctx.Body
+	case "list-id", "listid":
+		actual = ctx.ListID
+	case "size":
+		actual = strconv.Itoa(ctx.Size)
+	default:
+		actual = ctx.Headers[strings.ToLower(c.Field)]
+	}
+
+	switch strings.ToLower(c.Op) {
+	case "contains":
+		return strings.Contains(strings.ToLower(actual), strings.ToLower(c.Value))
+	case "equals", "is":
+		return strings.EqualFold(actual, c.Value)
+	case "regex":
+		if c.Regex == nil {
+			return false
+		}
+		return c.Regex.MatchString(actual)
+	case "gt":
+		n, err := strconv.Atoi(actual)
+		threshold, err2 := strconv.Atoi(c.Value)
+		return err == nil && err2 == nil && n > threshold
+	case "lt":
+		n, err := strconv.Atoi(actual)
+		threshold, err2 := strconv.Atoi(c.Value)
+		return err == nil && err2 == nil && n < threshold
+	default:
+		return false
+	}
+}
+
+type andCondition struct{ children []Condition }
+
+func (c *andCondition) Match(ctx Context) bool {
+	for _, child := range c.children {
+		if !child.Match(ctx) {
+			return false
+		}
+	}
+	return true
+}
+
+type orCondition struct{ children []Condition }
+
+func (c *orCondition) Match(ctx Context) bool {
+	for _, child := range c.children {
+		if child.Match(ctx) {
+			return true
+		}
+	}
+	return false
+}
+
+type notCondition struct{ child Condition }
+
+func (c *notCondition) Match(ctx Context) bool {
+	return !c.child.Match(ctx)
+}
+
+// rawCondition is the on-the-wire shape accepted by Parse.
+type rawCondition struct {
+	Field string         `json:"field,omitempty"`
+	Op    string         `json:"op,omitempty"`
+	Value string         `json:"value,omitempty"`
+	And   []rawCondition `json:"and,omitempty"`
+	Or    []rawCondition `json:"or,omitempty"`
+	Not   *rawCondition  `json:"not,omitempty"`
+}
+
+// Parse turns a JSON condition expression into a matchable Condition tree.
+func Parse(expr string) (Condition, error) {
+	var raw rawCondition
+	if err := json.Unmarshal([]byte(expr), &raw); err != nil {
+		return nil, fmt.Errorf("parse condition: %w", err)
+	}
+	return build(raw)
+}
+
+func build(raw rawCondition) (Condition, error) {
+	switch {
+	case len(raw.And) > 0:
+		children, err := buildAll(raw.And)
+		if err != nil {
+			return nil, err
+		}
+		return &andCondition{children: children}, nil
+
+	case len(raw.Or) > 0:
+		children, err := buildAll(raw.Or)
+		if err != nil {
+			return nil, err
+		}
+		return &orCondition{children: children}, nil
+
+	case raw.Not != nil:
+		child, err := build(*raw.Not)
+		if err != nil {
+			return nil, err
+		}
+		return &notCondition{child: child}, nil
+
+	default:
+		fc := &fieldCondition{Field: raw.Field, Op: raw.Op, Value: raw.Value}
+		if strings.ToLower(raw.Op) == "regex" {
+			re, err := regexp.Compile(raw.Value)
+			if err != nil {
+				return nil, fmt.Errorf("compile regex %q: %w", raw.Value, err)
+			}
+			fc.Regex = re
+		}
+		return fc, nil
+	}
+}
+
+func buildAll(raws []rawCondition) ([]Condition, error) {
+	out := make([]Condition, 0, len(raws))
+	for _, r := range raws {
+		c, err := build(r)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
+
+// Action is one side effect to apply when a rule matches.
+type Action struct {
+	Type   string            `json:"type"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// ParseActions decodes the JSON array stored in Rule.ActionsJSON.
+func ParseActions(raw string) ([]Action, error) {
+	var actions []Action
+	if err := json.Unmarshal([]byte(raw), &actions); err != nil {
+		return nil, fmt.Errorf("parse actions: %w", err)
+	}
+	return actions, nil
+}
+
+// CompiledRule pairs a parsed condition with its actions and originating ID,
+// ready to be evaluated against a message.
+type CompiledRule struct {
+	ID        uint
+	Priority  int
+	Condition Condition
+	Actions   []Action
+}
+
+// Compile parses a rule's stored condition/actions into a CompiledRule.
+func Compile(id uint, priority int, conditionExpr, actionsJSON string) (*CompiledRule, error) {
+	cond, err := Parse(conditionExpr)
+	if err != nil {
+		return nil, err
+	}
+	actions, err := ParseActions(actionsJSON)
+	if err != nil {
+		return nil, err
+	}
+	return &CompiledRule{ID: id, Priority: priority, Condition: cond, Actions: actions}, nil
+}
+
+// Evaluate runs rules (assumed already sorted by priority) against ctx and
+// returns the actions of every matching rule, in priority order. Evaluation
+// stops as soon as a matching rule includes a "drop" action, since nothing
+// after it can un-drop the message.
+func Evaluate(rules []*CompiledRule, ctx Context) []Action {
+	var actions []Action
+	for _, r := range rules {
+		if !r.Condition.Match(ctx) {
+			continue
+		}
+		actions = append(actions, r.Actions...)
+		for _, a := range r.Actions {
+			if a.Type == "drop" {
+				return actions
+			}
+		}
+	}
+	return actions
+}
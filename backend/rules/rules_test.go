@@ -0,0 +1,130 @@
+package rules
+
+import "testing"
+
+func TestFieldConditionMatch(t *testing.T) {
+	ctx := Context{
+		From:    "newsletter@example.com",
+		Subject: "Weekly Digest",
+		ListID:  "digest.example.com",
+		Size:    4096,
+		Headers: map[string]string{"x-priority": "1"},
+	}
+
+	cases := []struct {
+		name string
+		cond string
+		want bool
+	}{
+		{"contains", `{"field":"subject","op":"contains","value":"digest"}`, true},
+		{"contains miss", `{"field":"subject","op":"contains","value":"invoice"}`, false},
+		{"equals case-insensitive", `{"field":"from","op":"equals","value":"NEWSLETTER@EXAMPLE.COM"}`, true},
+		{"list-id", `{"field":"list-id","op":"equals","value":"digest.example.com"}`, true},
+		{"custom header", `{"field":"x-priority","op":"equals","value":"1"}`, true},
+		{"size gt", `{"field":"size","op":"gt","value":"1000"}`, true},
+		{"size lt", `{"field":"size","op":"lt","value":"1000"}`, false},
+		{"regex", `{"field":"subject","op":"regex","value":"^Weekly"}`, true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cond, err := Parse(tc.cond)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tc.cond, err)
+			}
+			if got := cond.Match(ctx); got != tc.want {
+				t.Errorf("Match() = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseBooleanCombinators(t *testing.T) {
+	ctx := Context{From: "a@example.com", Subject: "hello"}
+
+	and := `{"and":[{"field":"from","op":"contains","value":"example"},{"field":"subject","op":"equals","value":"hello"}]}`
+	cond, err := Parse(and)
+	if err != nil {
+		t.Fatalf("Parse(and): %v", err)
+	}
+	if !cond.Match(ctx) {
+		t.Error("expected and-condition to match")
+	}
+
+	or := `{"or":[{"field":"subject","op":"equals","value":"nope"},{"field":"subject","op":"equals","value":"hello"}]}`
+	cond, err = Parse(or)
+	if err != nil {
+		t.Fatalf("Parse(or): %v", err)
+	}
+	if !cond.Match(ctx) {
+		t.Error("expected or-condition to match")
+	}
+
+	not := `{"not":{"field":"subject","op":"equals","value":"nope"}}`
+	cond, err = Parse(not)
+	if err != nil {
+		t.Fatalf("Parse(not): %v", err)
+	}
+	if !cond.Match(ctx) {
+		t.Error("expected not-condition to match")
+	}
+}
+
+func TestEvaluateStopsOnDrop(t *testing.T) {
+	always := &fieldCondition{Field: "from", Op: "contains", Value: ""}
+
+	rules := []*CompiledRule{
+		{ID: 1, Priority: 0, Condition: always, Actions: []Action{{Type: "tag", Params: map[string]string{"name": "one"}}}},
+		{ID: 2, Priority: 1, Condition: always, Actions: []Action{{Type: "drop"}}},
+		{ID: 3, Priority: 2, Condition: always, Actions: []Action{{Type: "tag", Params: map[string]string{"name": "three"}}}},
+	}
+
+	actions := Evaluate(rules, Context{From: "x@example.com"})
+
+	if len(actions) != 2 {
+		t.Fatalf("expected actions from rule 1 and the drop itself, got %d: %+v", len(actions), actions)
+	}
+	if actions[0].Type != "tag" || actions[1].Type != "drop" {
+		t.Errorf("unexpected action order: %+v", actions)
+	}
+}
+
+func TestParseSieve(t *testing.T) {
+	script := `
+if header :contains "List-Id" "announce.example.com" {
+	fileinto "Announcements";
+}
+if header :is "From" "spam@bad.example" {
+	discard;
+}
+`
+	imported, err := ParseSieve(script)
+	if err != nil {
+		t.Fatalf("ParseSieve: %v", err)
+	}
+	if len(imported) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(imported))
+	}
+
+	actions, err := ParseActions(imported[0].ActionsJSON)
+	if err != nil {
+		t.Fatalf("ParseActions: %v", err)
+	}
+	if len(actions) != 1 || actions[0].Type != "move_imap" || actions[0].Params["folder"] != "Announcements" {
+		t.Errorf("unexpected actions for first rule: %+v", actions)
+	}
+
+	cond, err := Parse(imported[1].ConditionExpr)
+	if err != nil {
+		t.Fatalf("Parse(%q): %v", imported[1].ConditionExpr, err)
+	}
+	if !cond.Match(Context{From: "spam@bad.example"}) {
+		t.Error("expected the :is condition to match an exact From")
+	}
+}
+
+func TestParseSieveRejectsUnsupportedConstructs(t *testing.T) {
+	if _, err := ParseSieve(`if anyof (true, false) { discard; }`); err == nil {
+		t.Error("expected an error for an unsupported sieve construct")
+	}
+}
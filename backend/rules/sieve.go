@@ -0,0 +1,106 @@
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ImportedRule is one rule extracted from a Sieve script by ParseSieve,
+// ready to be inserted as a Rule row.
+type ImportedRule struct {
+	ConditionExpr string
+	ActionsJSON   string
+}
+
+var sieveIfRe = regexp.MustCompile(`(?i)^\s*if\s+header\s+(:contains|:is)\s+"([^"]+)"\s+"([^"]*)"\s*\{`)
+var sieveFileintoRe = regexp.MustCompile(`(?i)fileinto\s+"([^"]*)"\s*;`)
+var sieveDiscardRe = regexp.MustCompile(`(?i)discard\s*;`)
+
+// ParseSieve understands a small, commonly-used subset of RFC 5228: single
+// `if header :contains/:is "field" "value" { actions }` blocks containing
+// `fileinto "folder";` and/or `discard;`. Anything more advanced (elsif,
+// allof/anyof, other tests) is rejected rather than silently misinterpreted.
+func ParseSieve(script string) ([]ImportedRule, error) {
+	var out []ImportedRule
+
+	blocks := splitSieveBlocks(script)
+	for _, block := range blocks {
+		m := sieveIfRe.FindStringSubmatch(block)
+		if m == nil {
+			return nil, fmt.Errorf("unsupported sieve construct: %q", firstLine(block))
+		}
+
+		op := "contains"
+		if strings.EqualFold(m[1], ":is") {
+			op = "equals"
+		}
+		field, value := m[2], m[3]
+
+		condition := fmt.Sprintf(`{"field":%q,"op":%q,"value":%q}`, field, op, value)
+
+		var actions []string
+		if fm := sieveFileintoRe.FindStringSubmatch(block); fm != nil {
+			actions = append(actions, fmt.Sprintf(`{"type":"move_imap","params":{"folder":%q}}`, fm[1]))
+		}
+		if sieveDiscardRe.MatchString(block) {
+			actions = append(actions, `{"type":"drop"}`)
+		}
+		if len(actions) == 0 {
+			return nil, fmt.Errorf("sieve block has no supported action: %q", firstLine(block))
+		}
+
+		out = append(out, ImportedRule{
+			ConditionExpr: condition,
+			ActionsJSON:   "[" + strings.Join(actions, ",") + "]",
+		})
+	}
+
+	return out, nil
+}
+
+// splitSieveBlocks splits a script into top-level `if ... { ... }` blocks by
+// brace depth, ignoring braces inside quoted strings.
+func splitSieveBlocks(script string) []string {
+	var blocks []string
+	var depth int
+	var start int
+	inString := false
+
+	for i, r := range script {
+		switch r {
+		case '"':
+			inString = !inString
+		case '{':
+			if !inString {
+				if depth == 0 {
+					start = firstNonSpaceBefore(script, i)
+				}
+				depth++
+			}
+		case '}':
+			if !inString && depth > 0 {
+				depth--
+				if depth == 0 {
+					blocks = append(blocks, script[start:i+1])
+				}
+			}
+		}
+	}
+	return blocks
+}
+
+func firstNonSpaceBefore(s string, idx int) int {
+	start := idx
+	for start > 0 && s[start-1] != '\n' {
+		start--
+	}
+	return start
+}
+
+func firstLine(s string) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return s[:i]
+	}
+	return s
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore writes blobs under a root directory on local disk, sharded two
+// levels deep by the first four characters of the key to keep directories
+// from growing unbounded.
+type LocalStore struct {
+	root string
+}
+
+func NewLocal(root string) *LocalStore {
+	return &LocalStore{root: root}
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	rel := shardedPath(key)
+	full := filepath.Join(s.root, rel)
+
+	if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+		return "", fmt.Errorf("mkdir: %w", err)
+	}
+
+	f, err := os.Create(full)
+	if err != nil {
+		return "", fmt.Errorf("create: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, r); err != nil {
+		return "", fmt.Errorf("write: %w", err)
+	}
+
+	return full, nil
+}
+
+func (s *LocalStore) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func shardedPath(key string) string {
+	if len(key) < 4 {
+		return key
+	}
+	return filepath.Join(key[:2], key[2:4], key)
+}
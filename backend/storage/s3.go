@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// S3Store writes blobs to an S3 (or S3-compatible) bucket under an optional
+// key prefix.
+type S3Store struct {
+	client *s3.Client
+	bucket string
+	prefix string
+}
+
+func NewS3(bucket, prefix string) (*S3Store, error) {
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("load AWS config: %w", err)
+	}
+	return &S3Store{
+		client: s3.NewFromConfig(cfg),
+		bucket: bucket,
+		prefix: prefix,
+	}, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, r io.Reader) (string, error) {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("read body: %w", err)
+	}
+
+	objectKey := key
+	if s.prefix != "" {
+		objectKey = s.prefix + "/" + key
+	}
+
+	_, err = s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(objectKey),
+		Body:   bytes.NewReader(buf),
+	})
+	if err != nil {
+		return "", fmt.Errorf("put object: %w", err)
+	}
+
+	return fmt.Sprintf("s3://%s/%s", s.bucket, objectKey), nil
+}
+
+func (s *S3Store) Get(ctx context.Context, path string) (io.ReadCloser, error) {
+	bucket, key, err := parseS3Path(path)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+	return out.Body, nil
+}
+
+func parseS3Path(path string) (bucket, key string, err error) {
+	const schemePrefix = "s3://"
+	if len(path) <= len(schemePrefix) || path[:len(schemePrefix)] != schemePrefix {
+		return "", "", fmt.Errorf("not an s3 path: %s", path)
+	}
+	rest := path[len(schemePrefix):]
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == '/' {
+			return rest[:i], rest[i+1:], nil
+		}
+	}
+	return "", "", fmt.Errorf("missing key in s3 path: %s", path)
+}
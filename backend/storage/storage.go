@@ -0,0 +1,53 @@
+// Package storage persists message bodies and attachments as content-addressed
+// blobs, either on local disk or in S3, behind a single small interface so the
+// caller doesn't need to know which backend is configured.
+package storage
+
+import (
+	"context"
+	"io"
+)
+
+// Blob stores raw attachment/body bytes under a key and returns a
+// backend-specific path/URI that can be used to retrieve it later.
+type Blob interface {
+	Put(ctx context.Context, key string, r io.Reader) (path string, err error)
+	Get(ctx context.Context, path string) (io.ReadCloser, error)
+}
+
+// New builds a Blob backend from a storage URI: "file:///var/lib/..." for
+// local disk or "s3://bucket/prefix" for S3.
+func New(uri string) (Blob, error) {
+	scheme, rest, ok := splitScheme(uri)
+	if !ok {
+		return NewLocal(uri), nil
+	}
+
+	switch scheme {
+	case "file":
+		return NewLocal(rest), nil
+	case "s3":
+		bucket, prefix := splitBucketPrefix(rest)
+		return NewS3(bucket, prefix)
+	default:
+		return NewLocal(uri), nil
+	}
+}
+
+func splitScheme(uri string) (scheme, rest string, ok bool) {
+	for i := 0; i+2 < len(uri); i++ {
+		if uri[i] == ':' && uri[i+1] == '/' && uri[i+2] == '/' {
+			return uri[:i], uri[i+3:], true
+		}
+	}
+	return "", uri, false
+}
+
+func splitBucketPrefix(rest string) (bucket, prefix string) {
+	for i := 0; i < len(rest); i++ {
+		if rest[i] == '/' {
+			return rest[:i], rest[i+1:]
+		}
+	}
+	return rest, ""
+}
@@ -0,0 +1,97 @@
+package storage
+
+import "testing"
+
+func TestSplitScheme(t *testing.T) {
+	cases := []struct {
+		uri    string
+		scheme string
+		rest   string
+		wantOK bool
+	}{
+		{"s3://my-bucket/prefix", "s3", "my-bucket/prefix", true},
+		{"file:///var/lib/blobs", "file", "/var/lib/blobs", true},
+		{"/var/lib/blobs", "", "/var/lib/blobs", false},
+		{"relative/path", "", "relative/path", false},
+	}
+
+	for _, tc := range cases {
+		scheme, rest, ok := splitScheme(tc.uri)
+		if scheme != tc.scheme || rest != tc.rest || ok != tc.wantOK {
+			t.Errorf("splitScheme(%q) = (%q, %q, %v), want (%q, %q, %v)",
+				tc.uri, scheme, rest, ok, tc.scheme, tc.rest, tc.wantOK)
+		}
+	}
+}
+
+func TestSplitBucketPrefix(t *testing.T) {
+	cases := []struct {
+		rest   string
+		bucket string
+		prefix string
+	}{
+		{"my-bucket/prefix/path", "my-bucket", "prefix/path"},
+		{"my-bucket", "my-bucket", ""},
+		{"my-bucket/", "my-bucket", ""},
+	}
+
+	for _, tc := range cases {
+		bucket, prefix := splitBucketPrefix(tc.rest)
+		if bucket != tc.bucket || prefix != tc.prefix {
+			t.Errorf("splitBucketPrefix(%q) = (%q, %q), want (%q, %q)",
+				tc.rest, bucket, prefix, tc.bucket, tc.prefix)
+		}
+	}
+}
+
+func TestShardedPath(t *testing.T) {
+	cases := []struct {
+		key  string
+		want string
+	}{
+		{"abcdef0123456789", "ab/cd/abcdef0123456789"},
+		{"abc", "abc"},
+		{"", ""},
+	}
+
+	for _, tc := range cases {
+		if got := shardedPath(tc.key); got != tc.want {
+			t.Errorf("shardedPath(%q) = %q, want %q", tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestParseS3Path(t *testing.T) {
+	bucket, key, err := parseS3Path("s3://my-bucket/ab/cd/abcdef")
+	if err != nil {
+		t.Fatalf("parseS3Path: %v", err)
+	}
+	if bucket != "my-bucket" || key != "ab/cd/abcdef" {
+		t.Errorf("parseS3Path = (%q, %q), want (%q, %q)", bucket, key, "my-bucket", "ab/cd/abcdef")
+	}
+
+	if _, _, err := parseS3Path("not-an-s3-path"); err == nil {
+		t.Error("expected an error for a path without the s3:// scheme")
+	}
+	if _, _, err := parseS3Path("s3://bucket-with-no-key"); err == nil {
+		t.Error("expected an error for an s3 path missing a key")
+	}
+}
+
+func TestNewDispatchesByScheme(t *testing.T) {
+	blob, err := New("file:///tmp/blobs")
+	if err != nil {
+		t.Fatalf("New(file://): %v", err)
+	}
+	if _, ok := blob.(*LocalStore); !ok {
+		t.Errorf("New(file://) = %T, want *LocalStore", blob)
+	}
+
+	blob, err = New("/tmp/blobs")
+	if err != nil {
+		t.Fatalf("New(plain path): %v", err)
+	}
+	if _, ok := blob.(*LocalStore); !ok {
+		t.Errorf("New(plain path) = %T, want *LocalStore", blob)
+	}
+}
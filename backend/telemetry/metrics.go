@@ -0,0 +1,59 @@
+// Package telemetry wires up the Prometheus metrics, request correlation
+// IDs, and OpenTelemetry tracing used to make the poll workers and REST
+// API observable in production.
+package telemetry
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// CheckDuration records how long a single IMAP/POP3 check took, labeled by
+// account, protocol ("imap"/"pop3"), and result ("ok"/"error").
+var CheckDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "email_check_duration_seconds",
+	Help:    "Duration of a single mailbox check.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"account", "protocol", "result"})
+
+// CheckTotal counts mailbox checks, labeled by account and result.
+var CheckTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "email_check_total",
+	Help: "Total number of mailbox checks performed.",
+}, []string{"account", "result"})
+
+// EmailsNewTotal counts newly discovered messages per account.
+var EmailsNewTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "emails_new_total",
+	Help: "Total number of new messages discovered.",
+}, []string{"account"})
+
+// WebsocketClients tracks the number of currently connected WebSocket
+// clients.
+var WebsocketClients = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "websocket_clients",
+	Help: "Number of currently connected WebSocket clients.",
+})
+
+// WebsocketBroadcastErrorsTotal counts failed per-client broadcast writes.
+var WebsocketBroadcastErrorsTotal = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "websocket_broadcast_errors_total",
+	Help: "Total number of errors writing a broadcast message to a WebSocket client.",
+})
+
+// DBQueryDuration records how long individual DB calls take, labeled by the
+// logical operation name (e.g. "find_accounts", "find_rules").
+var DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Duration of a database query.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"operation"})
+
+// Handler serves the Prometheus exposition format for app.Get("/metrics",
+// telemetry.Handler()).
+func Handler() fiber.Handler {
+	return adaptor.HTTPHandler(promhttp.Handler())
+}
@@ -0,0 +1,114 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies this package's spans in whatever backend
+// OTEL_EXPORTER_OTLP_ENDPOINT points at.
+const tracerName = "email-notifier"
+
+// InitTracer configures the global OTel tracer provider to batch-export
+// spans via OTLP/gRPC. The exporter itself reads OTEL_EXPORTER_OTLP_ENDPOINT
+// (and friends, e.g. OTEL_EXPORTER_OTLP_HEADERS) from the environment, so
+// there's nothing to wire here beyond the service name. The returned
+// shutdown func flushes and closes the exporter; call it on process exit.
+func InitTracer(ctx context.Context, serviceName string) (shutdown func(context.Context) error, err error) {
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(semconv.ServiceNameKey.String(serviceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+func tracer() trace.Tracer {
+	return otel.Tracer(tracerName)
+}
+
+// StartSpan starts a span for an outbound operation -- an IMAP/POP3 dial,
+// a DB call -- that isn't already wrapped by Middleware.
+func StartSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// requestIDLocal is the fiber.Locals key Middleware stores the per-request
+// correlation ID under.
+const requestIDLocal = "requestID"
+
+// Middleware assigns every request a correlation ID (reusing an inbound
+// X-Request-ID if the caller already set one), echoes it back in the
+// response, wraps the handler in a span, and logs the outcome through
+// slog with the correlation ID attached.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		reqID := c.Get("X-Request-ID")
+		if reqID == "" {
+			reqID = generateRequestID()
+		}
+		c.Locals(requestIDLocal, reqID)
+		c.Set("X-Request-ID", reqID)
+
+		ctx, span := tracer().Start(c.UserContext(), c.Method()+" "+c.Route().Path,
+			trace.WithAttributes(
+				attribute.String("http.method", c.Method()),
+				attribute.String("http.route", c.Route().Path),
+				attribute.String("request_id", reqID),
+			))
+		defer span.End()
+		c.SetUserContext(ctx)
+
+		handlerErr := c.Next()
+
+		status := c.Response().StatusCode()
+		span.SetAttributes(attribute.Int("http.status_code", status))
+
+		level := slog.LevelInfo
+		if status >= 500 || handlerErr != nil {
+			level = slog.LevelError
+		}
+		slog.Log(ctx, level, "request",
+			"request_id", reqID,
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+		)
+		return handlerErr
+	}
+}
+
+// RequestID returns the correlation ID Middleware assigned to c, or "" if
+// Middleware isn't installed on this route.
+func RequestID(c *fiber.Ctx) string {
+	id, _ := c.Locals(requestIDLocal).(string)
+	return id
+}
+
+func generateRequestID() string {
+	buf := make([]byte, 12)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}